@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"user-service/api/handlers"
+	"user-service/config"
+	"user-service/kafka"
+	"user-service/server"
+	"user-service/service"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const adminRealm = "user-service admin"
+
+var ErrAdminAuthRequired = errors.New("admin server outside loopback requires basic auth or client certificates")
+
+type AdminServerBuilder struct {
+	router chi.Router
+	server server.Server
+	log    *zap.Logger
+}
+
+func NewAdminServerBuilder(ctx context.Context, log *zap.Logger, settings config.Settings) (*AdminServerBuilder, error) {
+	if err := checkAdminExposure(settings.Admin); err != nil {
+		return nil, err
+	}
+
+	srv, err := newHTTPServer(ctx, log, settings.Admin.Address, settings.Admin.Timeouts, settings.Admin.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	router := chi.NewRouter()
+
+	router.Use(middleware.Recoverer)
+	router.Use(middleware.Heartbeat("/ping"))
+
+	auth := settings.Admin.Auth
+	if len(auth.Username) > 0 {
+		router.Use(middleware.BasicAuth(adminRealm, map[string]string{
+			auth.Username: auth.Password,
+		}))
+	}
+
+	router.Mount("/debug", middleware.Profiler())
+	router.Handle("/metrics", expvar.Handler())
+
+	return &AdminServerBuilder{
+		router: router,
+		server: srv,
+		log:    log,
+	}, nil
+}
+
+// checkAdminExposure не дает открыть pprof и управление консьюмером без аутентификации на внешних интерфейсах.
+// Unix-сокет защищают права на файл, а сокет от systemd - настройки его юнита, поэтому они не проверяются
+func checkAdminExposure(settings config.Admin) error {
+	if len(settings.Auth.Username) > 0 || !server.IsTCPAddress(settings.Address) {
+		return nil
+	}
+
+	tlsSettings := settings.TLS
+	if len(tlsSettings.ClientCAFile) > 0 && (len(tlsSettings.ClientAuth) == 0 || tlsSettings.ClientAuth == "require_and_verify") {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(settings.Address)
+	if err != nil {
+		return fmt.Errorf("could not parse admin address %q: %w", settings.Address, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrAdminAuthRequired, settings.Address)
+}
+
+func (s *AdminServerBuilder) AddHealth(postgres *sqlx.DB) {
+	s.router.Get("/health", handlers.HealthHandler(postgres, s.log))
+}
+
+func (s *AdminServerBuilder) AddKafka(redriver *kafka.Redriver) {
+	s.router.Post("/kafka/dead-letter/redrive", handlers.RedriveDeadLetterHandler(redriver, s.log))
+}
+
+func (s *AdminServerBuilder) AddConsumer(consumer kafka.Consumer) {
+	s.router.Get("/kafka/consumer", handlers.ConsumerStateHandler(consumer))
+	s.router.Post("/kafka/consumer/pause", handlers.PauseConsumerHandler(consumer, s.log))
+	s.router.Post("/kafka/consumer/resume", handlers.ResumeConsumerHandler(consumer, s.log))
+	s.router.Post("/kafka/consumer/seek", handlers.SeekConsumerHandler(consumer, s.log))
+	s.router.Get("/kafka/consumer/lag", handlers.ConsumerLagHandler(consumer, s.log))
+}
+
+// AddUsers добавляет создание пользователей с заданным Id и изменение полей, которые проверяет политика бронирования,
+// закрытые от публичного API
+func (s *AdminServerBuilder) AddUsers(user service.User) {
+	s.router.Post("/users/import", handlers.ImportUserHandler(user, s.log))
+	s.router.Put("/users/{id}/verification", handlers.UpdateUserVerificationHandler(user, s.log))
+}
+
+func (s *AdminServerBuilder) AddTickets(user service.User) {
+	s.router.Get("/tickets/conflicts", handlers.TicketConflictsHandler(user, s.log))
+}
+
+func (s *AdminServerBuilder) Build() server.Server {
+	s.server.UseHandler(s.router)
+
+	return s.server
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"user-service/config"
+)
+
+func TestCheckAdminExposure(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings config.Admin
+		err      error
+	}{
+		{name: "loopback", settings: config.Admin{Address: "127.0.0.1:8081"}},
+		{name: "localhost", settings: config.Admin{Address: "localhost:8081"}},
+		{name: "ipv6 loopback", settings: config.Admin{Address: "[::1]:8081"}},
+		{name: "all interfaces", settings: config.Admin{Address: ":8081"}, err: ErrAdminAuthRequired},
+		{name: "external ip", settings: config.Admin{Address: "10.0.0.1:8081"}, err: ErrAdminAuthRequired},
+		{name: "unix socket", settings: config.Admin{Address: "unix:/run/user-service/admin.sock"}},
+		{name: "unix socket url", settings: config.Admin{Address: "unix:///run/user-service/admin.sock"}},
+		{name: "socket activation", settings: config.Admin{Address: "systemd"}},
+		{name: "named socket activation", settings: config.Admin{Address: "systemd:admin"}},
+		{
+			name:     "basic auth",
+			settings: config.Admin{Address: ":8081", Auth: config.AdminAuth{Username: "admin", Password: "secret"}},
+		},
+		{
+			name:     "client certificates",
+			settings: config.Admin{Address: ":8081", TLS: config.TLS{ClientCAFile: "ca.pem"}},
+		},
+		{
+			name:     "optional client certificates",
+			settings: config.Admin{Address: ":8081", TLS: config.TLS{ClientCAFile: "ca.pem", ClientAuth: "verify_if_given"}},
+			err:      ErrAdminAuthRequired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAdminExposure(test.settings)
+			if test.err == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const healthTimeout = 3 * time.Second
+
+// HealthHandler проверяет доступность зависимостей сервиса
+func HealthHandler(postgres *sqlx.DB, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+
+		if err := postgres.PingContext(ctx); err != nil {
+			log.Error("postgres health check failed", zap.Error(err))
+			render.Status(r, http.StatusServiceUnavailable)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, "ok")
+		return
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"user-service/kafka"
+
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+const defaultRedriveLimit = 100
+
+type RedriveResult struct {
+	Redriven int `json:"Redriven"`
+}
+
+type ConsumerState struct {
+	Paused bool `json:"Paused"`
+}
+
+// SeekRequest задает либо Offset, либо Timestamp. Offset -2 перематывает в начало партиции, -1 - в конец
+type SeekRequest struct {
+	Topic     string     `json:"Topic"`
+	Partition int        `json:"Partition"`
+	Offset    *int64     `json:"Offset"`
+	Timestamp *time.Time `json:"Timestamp"`
+}
+
+type SeekResult struct {
+	Offset int64 `json:"Offset"`
+}
+
+// RedriveDeadLetterHandler переносит сообщения из dead letter топика обратно в основной.
+// Параметр limit ограничивает количество сообщений, limit=0 переносит все
+func RedriveDeadLetterHandler(redriver *kafka.Redriver, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultRedriveLimit
+
+		if limitRaw := r.URL.Query().Get("limit"); len(limitRaw) > 0 {
+			parsed, err := strconv.Atoi(limitRaw)
+			if err != nil || parsed < 0 {
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, "wrong limit")
+				return
+			}
+
+			limit = parsed
+		}
+
+		count, err := redriver.Redrive(r.Context(), limit)
+		if err != nil {
+			log.Error("could not redrive dead letter messages", zap.Error(err), zap.Int("redriven", count))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, RedriveResult{Redriven: count})
+		return
+	}
+}
+
+func ConsumerStateHandler(consumer kafka.Consumer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, ConsumerState{Paused: consumer.Paused()})
+		return
+	}
+}
+
+// PauseConsumerHandler останавливает чтение после обработки уже прочитанных сообщений
+func PauseConsumerHandler(consumer kafka.Consumer, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := consumer.Pause(r.Context()); err != nil {
+			log.Error("could not pause kafka consumer", zap.Error(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		log.Info("kafka consumer paused")
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, ConsumerState{Paused: true})
+		return
+	}
+}
+
+func ResumeConsumerHandler(consumer kafka.Consumer, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := consumer.Resume(r.Context()); err != nil {
+			log.Error("could not resume kafka consumer", zap.Error(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		log.Info("kafka consumer resumed")
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, ConsumerState{Paused: false})
+		return
+	}
+}
+
+// SeekConsumerHandler перематывает партицию на смещение или время. На паузе должны стоять все реплики группы
+func SeekConsumerHandler(consumer kafka.Consumer, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request SeekRequest
+		if err := render.DecodeJSON(r.Body, &request); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		if len(request.Topic) == 0 || request.Partition < 0 || (request.Offset == nil) == (request.Timestamp == nil) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, "topic, partition and either offset or timestamp are required")
+			return
+		}
+
+		var (
+			offset int64
+			err    error
+		)
+		if request.Offset != nil {
+			offset = *request.Offset
+			err = consumer.SeekOffset(r.Context(), request.Topic, request.Partition, offset)
+		} else {
+			offset, err = consumer.SeekTimestamp(r.Context(), request.Topic, request.Partition, *request.Timestamp)
+		}
+
+		if err != nil {
+			switch {
+			case errors.Is(err, kafka.ErrNotPaused), errors.Is(err, kafka.ErrGroupActive):
+				render.Status(r, http.StatusConflict)
+			case errors.Is(err, kafka.ErrNoConsumerGroup):
+				render.Status(r, http.StatusBadRequest)
+			default:
+				log.Error("could not seek kafka consumer", zap.Error(err))
+				render.Status(r, http.StatusInternalServerError)
+			}
+
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		log.Info("kafka consumer seeked",
+			zap.String("topic", request.Topic),
+			zap.Int("partition", request.Partition),
+			zap.Int64("offset", offset))
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, SeekResult{Offset: offset})
+		return
+	}
+}
+
+func ConsumerLagHandler(consumer kafka.Consumer, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lag, err := consumer.Lag(r.Context())
+		if err != nil {
+			log.Error("could not get kafka consumer lag", zap.Error(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, lag)
+		return
+	}
+}
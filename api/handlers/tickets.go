@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"user-service/service"
+	"user-service/service/user"
+
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+// TicketConflictsHandler возвращает конфликты владения билетами. Параметр source=migration оставляет только дубли,
+// найденные при миграции, source=booking - только бронирования в карантине
+func TicketConflictsHandler(userService service.User, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := userService.GetTicketConflicts(r.Context(), log, r.URL.Query().Get("source"))
+		if err != nil {
+			if errors.Is(err, user.ErrUnknownConflictSource) {
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, err.Error())
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, result)
+		return
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"user-service/pkg"
+	"user-service/server"
 	"user-service/service"
 	"user-service/service/user"
 
@@ -77,17 +78,31 @@ func GetUsersHandler(userService service.User, log *zap.Logger) http.HandlerFunc
 	}
 }
 
-// AddUserHandler добавляет нового пользователя
+// AddUserHandler добавляет нового пользователя. Id генерирует сервис, Id, Status, Verified и BirthDate из тела запроса игнорируются
 //
-//	@Summary	Добавляет нового пользователя
-//	@Tags		user
-//	@Accept		json
-//	@Produce	json
-//	@Param		user	body		pkg.User	true	"User"
-//	@Success	200		{object}	string
-//	@Failure	400		{object}	string
-//	@Router		/user [post]
+//	@Summary		Добавляет нового пользователя
+//	@Description	Id пользователя генерирует сервис, Id из тела запроса игнорируется.
+//	@Description	Status, Verified и BirthDate из тела запроса игнорируются, их задает админский PUT /users/{id}/verification.
+//	@Description	Пользователя с заданным Id, например для привязки отложенных бронирований, создает админский POST /users/import
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			user	body		pkg.User	true	"User"
+//	@Success		200		{object}	string
+//	@Failure		400		{object}	string
+//	@Failure		409		{object}	string
+//	@Router			/user [post]
 func AddUserHandler(userService service.User, log *zap.Logger) http.HandlerFunc {
+	return addUserHandler(userService, log, false)
+}
+
+// ImportUserHandler добавляет пользователя с Id, статусом, подтверждением и датой рождения из тела запроса.
+// Доступен только на админском сервере: бронирования, отложенные до появления пользователя, привязываются к нему при создании
+func ImportUserHandler(userService service.User, log *zap.Logger) http.HandlerFunc {
+	return addUserHandler(userService, log, true)
+}
+
+func addUserHandler(userService service.User, log *zap.Logger, admin bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var u pkg.User
 		err := render.DecodeJSON(r.Body, &u)
@@ -97,9 +112,13 @@ func AddUserHandler(userService service.User, log *zap.Logger) http.HandlerFunc
 			return
 		}
 
+		if !admin {
+			u.Id, u.Status, u.Verified, u.BirthDate = uuid.Nil, "", false, nil
+		}
+
 		id, err := userService.AddUser(r.Context(), log, u)
 		if err != nil {
-			render.Status(r, http.StatusBadRequest)
+			render.Status(r, userErrorStatus(err))
 			render.JSON(w, r, err.Error())
 			return
 		}
@@ -110,17 +129,20 @@ func AddUserHandler(userService service.User, log *zap.Logger) http.HandlerFunc
 	}
 }
 
-// UpdateUserHandler обновляет пользователя
+// UpdateUserHandler обновляет email и имя пользователя
 //
-//	@Summary	Обновляет пользователя
-//	@Tags		user
-//	@Accept		json
-//	@Produce	json
-//	@Param		id		path		string		true	"User ID"
-//	@Param		user	body		pkg.User	true	"User"
-//	@Success	200		{object}	string
-//	@Failure	400		{object}	string
-//	@Router		/user [put]
+//	@Summary		Обновляет пользователя
+//	@Description	Меняет только Email, Name и Surname. Status, Verified и BirthDate задает админский PUT /users/{id}/verification
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string		true	"User ID"
+//	@Param			user	body		pkg.User	true	"User"
+//	@Success		200		{object}	string
+//	@Failure		400		{object}	string
+//	@Failure		404		{object}	string
+//	@Failure		409		{object}	string
+//	@Router			/user [put]
 func UpdateUserHandler(userService service.User, log *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idRaw := chi.URLParam(r, "id")
@@ -142,8 +164,38 @@ func UpdateUserHandler(userService service.User, log *zap.Logger) http.HandlerFu
 		u.Id = id
 
 		err = userService.UpdateUser(r.Context(), log, u)
+		if err != nil {
+			render.Status(r, userErrorStatus(err))
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, "ok")
+		return
+	}
+}
+
+// UpdateUserVerificationHandler меняет статус, подтверждение и дату рождения пользователя. Доступен только на админском сервере:
+// по этим полям политика бронирования решает, принять ли билет
+func UpdateUserVerificationHandler(userService service.User, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
 		if err != nil {
 			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, "wrong id")
+			return
+		}
+
+		var verification pkg.UserVerification
+		if err = render.DecodeJSON(r.Body, &verification); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		if err = userService.UpdateUserVerification(r.Context(), log, id, verification); err != nil {
+			render.Status(r, userErrorStatus(err))
 			render.JSON(w, r, err.Error())
 			return
 		}
@@ -163,6 +215,7 @@ func UpdateUserHandler(userService service.User, log *zap.Logger) http.HandlerFu
 //	@Param		id	path		string	true	"User ID"
 //	@Success	200	{object}	string
 //	@Failure	400	{object}	string
+//	@Failure	404	{object}	string
 //	@Router		/user/{id} [delete]
 func DeleteUserHandler(userService service.User, log *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -176,7 +229,7 @@ func DeleteUserHandler(userService service.User, log *zap.Logger) http.HandlerFu
 
 		err = userService.DeleteUser(r.Context(), log, id)
 		if err != nil {
-			render.Status(r, http.StatusBadRequest)
+			render.Status(r, userErrorStatus(err))
 			render.JSON(w, r, err.Error())
 			return
 		}
@@ -219,3 +272,77 @@ func GetUserTicketsByUserIdHandler(userService service.User, log *zap.Logger) ht
 		return
 	}
 }
+
+// TransferUserTicketHandler передает билет пользователя другому пользователю
+//
+//	@Summary	Передает билет другому пользователю по ID или email
+//	@Tags		user
+//	@Accept		json
+//	@Produce	json
+//	@Param		id			path		string						true	"User ID"
+//	@Param		ticketId	path		string						true	"Ticket ID"
+//	@Param		transfer	body		pkg.TicketTransferRequest	true	"Transfer"
+//	@Success	200			{object}	pkg.TicketTransfer
+//	@Failure	400			{object}	string
+//	@Failure	404			{object}	string
+//	@Failure	409			{object}	string
+//	@Router		/user/{id}/tickets/{ticketId}/transfer [post]
+func TransferUserTicketHandler(userService service.User, log *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idRaw := chi.URLParam(r, "id")
+		id, err := uuid.Parse(idRaw)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, "wrong id")
+			return
+		}
+
+		var request pkg.TicketTransferRequest
+		err = render.DecodeJSON(r.Body, &request)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		result, err := userService.TransferUserTicket(r.Context(), log, id, chi.URLParam(r, "ticketId"), request, initiator(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, user.ErrCouldNotFindUser), errors.Is(err, user.ErrCouldNotFindTicket):
+				render.Status(r, http.StatusNotFound)
+			case errors.Is(err, user.ErrTicketAlreadyOwned):
+				render.Status(r, http.StatusConflict)
+			default:
+				render.Status(r, http.StatusBadRequest)
+			}
+
+			render.JSON(w, r, err.Error())
+			return
+		}
+
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, result)
+		return
+	}
+}
+
+// initiator возвращает CN клиентского сертификата, а без mTLS - адрес клиента
+func initiator(r *http.Request) string {
+	if identity, ok := server.ClientIdentityFromContext(r.Context()); ok && len(identity.CommonName) > 0 {
+		return identity.CommonName
+	}
+
+	return r.RemoteAddr
+}
+
+// userErrorStatus выбирает HTTP статус для ошибки изменения пользователя
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, user.ErrCouldNotFindUser):
+		return http.StatusNotFound
+	case errors.Is(err, user.ErrUserAlreadyExists):
+		return http.StatusConflict
+	}
+
+	return http.StatusBadRequest
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"user-service/config"
+	"user-service/server"
+
+	"go.uber.org/zap"
+)
+
+func newHTTPServer(ctx context.Context, log *zap.Logger, addr string, timeouts config.HTTPTimeouts, tlsSettings config.TLS) (server.Server, error) {
+	options := []server.HTTPServerOption{
+		server.WithReadTimeout(timeouts.Read.Std()),
+		server.WithReadHeaderTimeout(timeouts.ReadHeader.Std()),
+		server.WithWriteTimeout(timeouts.Write.Std()),
+		server.WithIdleTimeout(timeouts.Idle.Std()),
+	}
+
+	if tlsSettings.Enabled() {
+		tlsConfig, err := server.NewTLSConfig(ctx, log, tlsSettings)
+		if err != nil {
+			return nil, fmt.Errorf("could not configure tls for %s: %w", addr, err)
+		}
+
+		options = append(options, server.WithTLS(tlsConfig))
+	}
+
+	return server.NewHTTPServer(ctx, log, addr, options...), nil
+}
@@ -21,19 +21,28 @@ type ServerBuilder struct {
 	log    *zap.Logger
 }
 
-func NewServerBuilder(ctx context.Context, log *zap.Logger, settings config.Settings) *ServerBuilder {
+func NewServerBuilder(ctx context.Context, log *zap.Logger, settings config.Settings) (*ServerBuilder, error) {
+	addr := settings.Address
+	if len(addr) == 0 {
+		addr = fmt.Sprintf(":%d", settings.Port)
+	}
+
+	srv, err := newHTTPServer(ctx, log, addr, settings.Timeouts, settings.TLS)
+	if err != nil {
+		return nil, err
+	}
+
 	router := chi.NewRouter()
 
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
-	router.Use(middleware.Heartbeat("/ping"))
-	router.Mount("/debug", middleware.Profiler())
+	router.Use(server.ClientIdentityMiddleware)
 
 	return &ServerBuilder{
 		router: router,
-		server: server.NewHTTPServer(ctx, log, fmt.Sprintf(":%d", settings.Port)),
+		server: srv,
 		log:    log,
-	}
+	}, nil
 }
 
 func (s *ServerBuilder) AddSwagger() {
@@ -47,6 +56,7 @@ func (s *ServerBuilder) AddUser(user service.User) {
 	s.router.Put("/user/{id}", handlers.UpdateUserHandler(user, s.log))
 	s.router.Delete("/user/{id}", handlers.DeleteUserHandler(user, s.log))
 	s.router.Get("/user/{id}/tickets", handlers.GetUserTicketsByUserIdHandler(user, s.log))
+	s.router.Post("/user/{id}/tickets/{ticketId}/transfer", handlers.TransferUserTicketHandler(user, s.log))
 }
 
 func (s *ServerBuilder) Build() server.Server {
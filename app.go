@@ -2,24 +2,42 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"os"
+	"slices"
 	"time"
 	"user-service/api"
 	"user-service/config"
 	"user-service/db"
+	"user-service/db/outbox"
 	dbuser "user-service/db/user"
 	"user-service/kafka"
+	"user-service/pkg"
 	"user-service/server"
 	"user-service/service"
 	"user-service/service/user"
+	"user-service/sync"
 
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
 const (
-	databaseTimeout = 15 * time.Second
+	databaseTimeout    = 15 * time.Second
+	redriveGroupSuffix = ".redrive"
+
+	defaultCleanupInterval  = time.Hour
+	defaultDeduplicationTTL = 7 * 24 * time.Hour
+
+	defaultPendingInterval = 5 * time.Minute
+	defaultPendingTTL      = 24 * time.Hour
+	defaultOutboxInterval  = time.Second
+	// outboxBatchTimeout пачка relay отправляется одной записью, ждать следующих сообщений незачем
+	outboxBatchTimeout = 10 * time.Millisecond
+
+	defaultCacheSize = 10000
+	defaultCacheTTL  = time.Minute
 )
 
 type App struct {
@@ -31,9 +49,21 @@ type App struct {
 	postgres *sqlx.DB
 
 	server      server.Server
+	adminServer server.Server
 	userService service.User
 	kafka       kafka.Kafka
+	registry    kafka.SchemaRegistry
 	consumer    kafka.Consumer
+	router      *kafka.Router
+	deadLetter  kafka.Producer
+	redrive     kafka.Producer
+	events      kafka.Producer
+	rejections  kafka.Producer
+	userEvents  kafka.Producer
+	userState   kafka.Producer
+	relay       *outbox.Relay
+	userCache   *dbuser.CachedRepository
+	redriver    *kafka.Redriver
 }
 
 func NewApp(ctx context.Context, log *zap.Logger, settings config.Settings) *App {
@@ -66,43 +96,368 @@ func (a *App) InitDatabases() error {
 }
 
 func (a *App) InitServices() error {
-	var err error
+	startOffset, err := kafka.ParseStartOffset(a.settings.Kafka.Consumer.StartOffset)
+	if err != nil {
+		return fmt.Errorf("could not parse kafka start offset: %w", err)
+	}
+
+	topics := a.settings.Kafka.Topics
+	consumerSettings := a.settings.Kafka.Consumer
+
+	subscriptions := a.subscriptions()
+	subscribedTopics := make([]string, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		subscribedTopics = append(subscribedTopics, subscription.Topic)
+	}
+
+	producerOptions, err := newProducerOptions(a.settings.Kafka.Producer)
+	if err != nil {
+		return fmt.Errorf("could not configure kafka producer: %w", err)
+	}
+
+	if err = a.initKafka(); err != nil {
+		return err
+	}
+
+	schemas, err := a.newSchemas()
+	if err != nil {
+		return err
+	}
 
-	a.kafka = kafka.NewKafka(a.settings.Kafka.Brokers)
+	a.deadLetter = a.kafka.Producer(topics.UserTicketsDeadLetter, producerOptions...)
 	a.consumer, err = a.kafka.Consumer(a.log, func() (context.Context, context.CancelFunc) {
 		return context.WithCancel(a.ctx)
-	}, kafka.WithTopic(a.settings.Kafka.Topics.UserTickets))
+	},
+		kafka.WithTopics(subscribedTopics...),
+		kafka.WithConsumerGroup(consumerSettings.GroupId),
+		kafka.WithOffset(startOffset),
+		kafka.WithCommitInterval(consumerSettings.CommitInterval.Std()),
+		kafka.WithRetry(newRetryPolicy(consumerSettings.Retry)),
+		kafka.WithDeadLetter(a.deadLetter),
+		kafka.WithWorkers(consumerSettings.Workers, consumerSettings.MaxInFlight),
+		kafka.WithShardKey(user.NewBookMessageShardKey(schemas)),
+		kafka.WithBatch(consumerSettings.Batch.Size, consumerSettings.Batch.Wait.Std()),
+	)
 	if err != nil {
 		return fmt.Errorf("could not create kafka consumer: %w", err)
 	}
 
-	userRepository := dbuser.NewRepository(a.postgres)
+	a.redrive = a.kafka.Producer("", producerOptions...)
+	a.redriver = kafka.NewRedriver(a.kafka, a.log, topics.UserTicketsDeadLetter, consumerSettings.GroupId+redriveGroupSuffix, topics.UserTickets, a.redrive)
+
+	outboxProducerOptions := append(slices.Clone(producerOptions), kafka.WithBatchTimeout(outboxBatchTimeout))
+	a.events = a.kafka.Producer(topics.TicketEvents, outboxProducerOptions...)
+	a.rejections = a.kafka.Producer(topics.BookingRejected, outboxProducerOptions...)
+	a.userEvents = a.kafka.Producer(topics.UserEvents, outboxProducerOptions...)
+	a.userState = a.kafka.Producer(topics.UserState, outboxProducerOptions...)
+	if err = a.kafka.EnsureCompactedTopic(a.ctx, topics.UserState); err != nil {
+		return fmt.Errorf("could not ensure user state topic: %w", err)
+	}
+
+	outboxSettings := a.settings.Outbox
+	a.relay = outbox.NewRelay(a.postgres, a.userEvents, a.log,
+		outbox.WithBatchSize(outboxSettings.BatchSize),
+		outbox.WithBackoff(outboxSettings.BackoffMin.Std(), outboxSettings.BackoffMax.Std()),
+		outbox.WithState(a.userState),
+		outbox.WithRoute(pkg.TicketTransferredType, a.events),
+		outbox.WithRoute(pkg.TicketOwnershipConflictType, a.events),
+		outbox.WithRoute(pkg.BookingRejectedType, a.rejections),
+	)
+
+	var userRepository dbuser.Repository = dbuser.NewRepository(a.postgres)
+	if cacheSettings := a.settings.Cache; cacheSettings.Enabled {
+		size := cacheSettings.Size
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+
+		a.userCache = dbuser.NewCachedRepository(userRepository, size,
+			durationOrDefault(cacheSettings.TTL, defaultCacheTTL), cacheSettings.NegativeTTL.Std())
+		expvar.Publish("user_cache", expvar.Func(func() any {
+			return a.userCache.Stats()
+		}))
+
+		userRepository = a.userCache
+	}
+
+	a.userService = user.NewService(userRepository,
+		user.WithPolicy(newBookingPolicy(a.settings.Booking, userRepository)),
+	)
 
-	a.userService = user.NewService(userRepository)
+	a.router, err = a.newRouter(a.userService)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (a *App) InitServer() {
-	sb := api.NewServerBuilder(a.ctx, a.log, a.settings)
+func (a *App) initKafka() error {
+	security, err := newKafkaSecurity(a.settings.Kafka)
+	if err != nil {
+		return fmt.Errorf("could not configure kafka security: %w", err)
+	}
+
+	switch a.settings.Kafka.Driver {
+	case "", kafka.DriverKafka:
+		a.kafka = kafka.NewKafka(a.settings.Kafka.Brokers, security)
+	case kafka.DriverMemory:
+		a.kafka = kafka.NewMemoryKafka(a.settings.Kafka.Memory.Partitions)
+	default:
+		return fmt.Errorf("unknown kafka driver %q", a.settings.Kafka.Driver)
+	}
+
+	registrySettings := a.settings.Kafka.SchemaRegistry
+	switch {
+	case len(registrySettings.URL) > 0:
+		a.registry = kafka.NewHTTPSchemaRegistry(registrySettings.URL, registrySettings.Username, registrySettings.Password)
+	case len(registrySettings.Dir) > 0:
+		a.registry, err = kafka.NewFileSchemaRegistry(registrySettings.Dir)
+		if err != nil {
+			return fmt.Errorf("could not load schema registry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// newSchemas регистрирует схемы сообщений подписок и подключает реестр схем, если он настроен
+func (a *App) newSchemas() (*kafka.Schemas, error) {
+	schemas := kafka.NewSchemas()
+	if err := user.RegisterMessageSchemas(schemas); err != nil {
+		return nil, fmt.Errorf("could not register message schemas: %w", err)
+	}
+
+	if a.registry != nil {
+		schemas.UseRegistry(a.registry)
+	}
+
+	return schemas, nil
+}
+
+// newRouter собирает цепочку обработки сообщений подписок поверх userService
+func (a *App) newRouter(userService service.User, middlewares ...kafka.Middleware) (*kafka.Router, error) {
+	schemas, err := a.newSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	router := kafka.NewRouter()
+	router.Use(kafka.Recoverer(a.log), kafka.Tracing(), kafka.Logger(a.log), kafka.Metrics(), kafka.Validate(schemas))
+	router.Use(middlewares...)
+	for _, subscription := range a.subscriptions() {
+		router.MapTopic(subscription.Topic, subscription.Type)
+	}
+
+	kafka.HandleJSON(router, pkg.BookMessageType, func(ctx context.Context, message kafka.Message, msg pkg.BookMessage) error {
+		return userService.HandleBookMessage(ctx, a.log, message, msg)
+	})
+	kafka.HandleBatchJSON(router, pkg.BookMessageType, func(ctx context.Context, messages []kafka.Message, msgs []pkg.BookMessage) error {
+		return userService.HandleBookMessages(ctx, a.log, messages, msgs)
+	})
+
+	return router, nil
+}
+
+func (a *App) subscriptions() []config.Subscription {
+	if len(a.settings.Kafka.Subscriptions) > 0 {
+		return a.settings.Kafka.Subscriptions
+	}
+
+	return []config.Subscription{{
+		Topic: a.settings.Kafka.Topics.UserTickets,
+		Type:  pkg.BookMessageType,
+	}}
+}
+
+func (a *App) InitServer() error {
+	sb, err := api.NewServerBuilder(a.ctx, a.log, a.settings)
+	if err != nil {
+		return fmt.Errorf("could not create server: %w", err)
+	}
+
 	sb.AddSwagger()
 	sb.AddUser(a.userService)
 	a.server = sb.Build()
+
+	asb, err := api.NewAdminServerBuilder(a.ctx, a.log, a.settings)
+	if err != nil {
+		return fmt.Errorf("could not create admin server: %w", err)
+	}
+
+	asb.AddHealth(a.postgres)
+	asb.AddKafka(a.redriver)
+	asb.AddConsumer(a.consumer)
+	asb.AddUsers(a.userService)
+	asb.AddTickets(a.userService)
+	a.adminServer = asb.Build()
+
+	return nil
 }
 
-func (a *App) Start() {
-	a.server.Start()
-	a.consumer.Subscribe(a.userService.CreateSubscriberForBookMessage(a.ctx, a.log))
+func (a *App) Start() error {
+	if err := a.server.Start(); err != nil {
+		return fmt.Errorf("could not start server: %w", err)
+	}
+
+	if err := a.adminServer.Start(); err != nil {
+		a.server.Stop()
+		return fmt.Errorf("could not start admin server: %w", err)
+	}
+
+	if a.settings.Kafka.Consumer.Batch.Size > 1 {
+		a.consumer.SubscribeBatch(a.router.BatchSubscriber(a.ctx, a.log))
+	} else {
+		a.consumer.Subscribe(a.router.Subscriber(a.ctx, a.log))
+	}
+
+	deduplication := a.settings.Kafka.Consumer.Deduplication
+	go sync.Every(a.ctx, durationOrDefault(deduplication.CleanupInterval, defaultCleanupInterval), func(ctx context.Context) {
+		_ = a.userService.CleanupProcessedMessages(ctx, a.log, durationOrDefault(deduplication.TTL, defaultDeduplicationTTL))
+	})
+
+	pending := a.settings.Kafka.Consumer.Pending
+	go sync.Every(a.ctx, durationOrDefault(pending.CleanupInterval, defaultPendingInterval), func(ctx context.Context) {
+		_ = a.userService.ExpirePendingUserTickets(ctx, a.log, durationOrDefault(pending.TTL, defaultPendingTTL))
+	})
+
+	go sync.Every(a.ctx, durationOrDefault(a.settings.Outbox.Interval, defaultOutboxInterval), func(ctx context.Context) {
+		_, _ = a.relay.Publish(ctx)
+	})
+
+	if a.userCache != nil {
+		go db.Listen(a.ctx, a.postgres, a.log, dbuser.UserChangedChannel, a.userCache.InvalidateAll, a.userCache.HandleNotification)
+	}
+
+	return nil
 }
 
 func (a *App) Stop(ctx context.Context) {
 	a.server.Stop()
+	a.adminServer.Stop()
 
 	if err := a.consumer.Close(ctx); err != nil {
 		a.log.Error("could not close kafka consumer", zap.Error(err))
 	}
 
+	for _, producer := range []kafka.Producer{a.deadLetter, a.redrive, a.events, a.rejections, a.userEvents, a.userState} {
+		if err := producer.Close(ctx); err != nil {
+			a.log.Error("could not close kafka producer", zap.Error(err))
+		}
+	}
+
 	if err := a.postgres.Close(); err != nil {
 		a.log.Error("could not close postgres connection", zap.Error(err))
 	}
 }
+
+// newBookingPolicy собирает правила приема бронирований из настроек. Возраст проверяется всегда,
+// потому что ограничение может прийти в самом бронировании
+func newBookingPolicy(settings config.Booking, repository dbuser.Repository) *user.Policy {
+	var rules []user.Rule
+
+	if settings.RejectSuspended {
+		rules = append(rules, user.RejectSuspended())
+	}
+	if settings.RequireVerified {
+		rules = append(rules, user.RequireVerified())
+	}
+
+	rules = append(rules, user.MinAge(settings.MinAge, time.Now))
+
+	if settings.MaxTicketsPerEvent > 0 {
+		rules = append(rules, user.MaxTicketsPerEvent(repository, settings.MaxTicketsPerEvent))
+	}
+
+	return user.NewPolicy(rules...)
+}
+
+func newRetryPolicy(settings config.KafkaRetry) kafka.RetryPolicy {
+	policy := kafka.DefaultRetryPolicy
+
+	if settings.MaxAttempts != 0 {
+		policy.MaxAttempts = settings.MaxAttempts
+	}
+	if settings.InitialBackoff > 0 {
+		policy.InitialBackoff = settings.InitialBackoff.Std()
+	}
+	if settings.MaxBackoff > 0 {
+		policy.MaxBackoff = settings.MaxBackoff.Std()
+	}
+
+	return policy
+}
+
+func newProducerOptions(settings config.KafkaProducer) ([]kafka.ProducerOption, error) {
+	acks, err := kafka.ParseRequiredAcks(settings.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+
+	compression, err := kafka.ParseCompression(settings.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	balancer, err := kafka.ParseBalancer(settings.Balancer)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []kafka.ProducerOption{
+		kafka.WithRequiredAcks(acks),
+		kafka.WithCompression(compression),
+		kafka.WithBalancer(balancer),
+		kafka.WithWriteRetry(settings.MaxAttempts, settings.BackoffMin.Std(), settings.BackoffMax.Std()),
+	}
+
+	if settings.WriteTimeout > 0 {
+		options = append(options, kafka.WithWriteTimeout(settings.WriteTimeout.Std()))
+	}
+
+	for key, value := range settings.Headers {
+		options = append(options, kafka.WithHeaders(kafka.Header{Key: key, Value: []byte(value)}))
+	}
+
+	return options, nil
+}
+
+func durationOrDefault(d config.Duration, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+
+	return d.Std()
+}
+
+func newKafkaSecurity(settings config.Kafka) (kafka.Security, error) {
+	var security kafka.Security
+
+	if settings.TLS.Enabled {
+		tlsConfig, err := kafka.NewTLSConfig(settings.TLS.CAFile, settings.TLS.CertFile, settings.TLS.KeyFile, settings.TLS.InsecureSkipVerify)
+		if err != nil {
+			return kafka.Security{}, err
+		}
+
+		security.TLS = tlsConfig
+	}
+
+	if len(settings.SASL.Mechanism) > 0 {
+		username, err := config.ReadSecret(settings.SASL.Username, settings.SASL.UsernameFile)
+		if err != nil {
+			return kafka.Security{}, err
+		}
+
+		password, err := config.ReadSecret(settings.SASL.Password, settings.SASL.PasswordFile)
+		if err != nil {
+			return kafka.Security{}, err
+		}
+
+		security.SASL, err = kafka.NewSASLMechanism(settings.SASL.Mechanism, username, password)
+		if err != nil {
+			return kafka.Security{}, err
+		}
+	}
+
+	return security, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+	"user-service/config"
+	dbuser "user-service/db/user"
+
+	"go.uber.org/zap"
+)
+
+const (
+	backfillCommand   = "backfill"
+	userStateBackfill = "user_state"
+)
+
+type backfillOptions struct {
+	batchSize int
+	rate      int
+	restart   bool
+}
+
+// runBackfill ставит в outbox снимки всех пользователей, relay работающего сервиса публикует их в топик состояния.
+// Позиция сохраняется после каждой пачки, прерванный backfill продолжается с нее
+func runBackfill(ctx context.Context, log *zap.Logger, settings config.Settings, args []string) error {
+	options, err := parseBackfillOptions(args)
+	if err != nil {
+		return err
+	}
+
+	app := NewApp(ctx, log, settings)
+	if err = app.InitDatabases(); err != nil {
+		return fmt.Errorf("could not init databases: %w", err)
+	}
+
+	defer func() {
+		if closeErr := app.postgres.Close(); closeErr != nil {
+			log.Error("could not close postgres connection", zap.Error(closeErr))
+		}
+	}()
+
+	repository := dbuser.NewRepository(app.postgres)
+	if options.restart {
+		if err = repository.ResetUserSnapshots(ctx, userStateBackfill); err != nil {
+			return fmt.Errorf("could not reset backfill progress: %w", err)
+		}
+	}
+
+	var total int
+	for {
+		count, err := repository.SnapshotUsers(ctx, userStateBackfill, options.batchSize)
+		if err != nil {
+			return fmt.Errorf("could not snapshot users: %w", err)
+		}
+
+		total += count
+		log.Info("backfill progress", zap.Int("batch", count), zap.Int("total", total))
+
+		if count < options.batchSize {
+			break
+		}
+
+		if err = options.throttle(ctx, count); err != nil {
+			return err
+		}
+	}
+
+	log.Info("backfill finished", zap.Int("total", total), zap.Bool("restart", options.restart))
+
+	return nil
+}
+
+// throttle выдерживает паузу, чтобы средняя скорость не превышала rate пользователей в секунду
+func (o backfillOptions) throttle(ctx context.Context, count int) error {
+	if o.rate <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(count) * time.Second / time.Duration(o.rate))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func parseBackfillOptions(args []string) (backfillOptions, error) {
+	flags := flag.NewFlagSet(backfillCommand, flag.ContinueOnError)
+
+	options := backfillOptions{}
+	flags.IntVar(&options.batchSize, "batch-size", 500, "users per transaction")
+	flags.IntVar(&options.rate, "rate", 1000, "max users per second, 0 for no limit")
+	flags.BoolVar(&options.restart, "restart", false, "start from the first user instead of the saved progress")
+
+	if err := flags.Parse(args); err != nil {
+		return backfillOptions{}, err
+	}
+
+	if options.batchSize < 1 {
+		return backfillOptions{}, errors.New("batch-size must be positive")
+	}
+	if options.rate < 0 {
+		return backfillOptions{}, errors.New("rate must not be negative")
+	}
+
+	return options, nil
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats счетчики кеша с момента создания
+type Stats struct {
+	Hits          int64 `json:"Hits"`
+	Misses        int64 `json:"Misses"`
+	Evictions     int64 `json:"Evictions"`
+	Invalidations int64 `json:"Invalidations"`
+	Size          int   `json:"Size"`
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// LRU кеш ограниченного размера: при переполнении вытесняется давно не читанный элемент.
+// У каждого элемента свой срок жизни, просроченный элемент считается промахом
+type LRU[K comparable, V any] struct {
+	mutex    *sync.Mutex
+	capacity int
+	items    map[K]*list.Element
+	order    *list.List
+	now      func() time.Time
+	stats    Stats
+}
+
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		mutex:    &sync.Mutex{},
+		capacity: max(capacity, 1),
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+
+		var zero V
+		return zero, false
+	}
+
+	item := element.Value.(*entry[K, V])
+	if !c.now().Before(item.expiresAt) {
+		c.removeLocked(element)
+		c.stats.Misses++
+
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+
+	return item.value, true
+}
+
+func (c *LRU[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*entry[K, V])
+		item.value = value
+		item.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+
+	for c.order.Len() > c.capacity {
+		c.removeLocked(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Delete удаляет элемент, например после изменения источника
+func (c *LRU[K, V]) Delete(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.removeLocked(element)
+	}
+	c.stats.Invalidations++
+}
+
+// Purge удаляет все элементы
+func (c *LRU[K, V]) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+	c.stats.Invalidations++
+}
+
+func (c *LRU[K, V]) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Size = c.order.Len()
+
+	return stats
+}
+
+func (c *LRU[K, V]) removeLocked(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*entry[K, V]).key)
+}
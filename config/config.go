@@ -1,9 +1,73 @@
 package config
 
 type Settings struct {
-	Port     int      `json:"port"`
-	Database Database `json:"database"`
-	Kafka    Kafka    `json:"kafka"`
+	Port     int          `json:"port"`
+	Address  string       `json:"address"`
+	Timeouts HTTPTimeouts `json:"timeouts"`
+	TLS      TLS          `json:"tls"`
+	Admin    Admin        `json:"admin"`
+	Database Database     `json:"database"`
+	Kafka    Kafka        `json:"kafka"`
+	Booking  Booking      `json:"booking"`
+	Outbox   Outbox       `json:"outbox"`
+	Cache    Cache        `json:"cache"`
+}
+
+// Booking правила приема бронирований. Нулевые значения отключают правило
+type Booking struct {
+	MaxTicketsPerEvent int  `json:"max_tickets_per_event"`
+	RejectSuspended    bool `json:"reject_suspended"`
+	RequireVerified    bool `json:"require_verified"`
+	MinAge             int  `json:"min_age"`
+}
+
+// Outbox настройки публикации событий пользователей из outbox
+type Outbox struct {
+	Interval   Duration `json:"interval"`
+	BatchSize  int      `json:"batch_size"`
+	BackoffMin Duration `json:"backoff_min"`
+	BackoffMax Duration `json:"backoff_max"`
+}
+
+// Cache настройки кеша пользователей. Нулевой negative_ttl отключает кеширование отсутствующих пользователей
+type Cache struct {
+	Enabled     bool     `json:"enabled"`
+	Size        int      `json:"size"`
+	TTL         Duration `json:"ttl"`
+	NegativeTTL Duration `json:"negative_ttl"`
+}
+
+type Admin struct {
+	Address  string       `json:"address"`
+	Timeouts HTTPTimeouts `json:"timeouts"`
+	TLS      TLS          `json:"tls"`
+	Auth     AdminAuth    `json:"auth"`
+}
+
+type AdminAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type HTTPTimeouts struct {
+	Read       Duration `json:"read"`
+	ReadHeader Duration `json:"read_header"`
+	Write      Duration `json:"write"`
+	Idle       Duration `json:"idle"`
+}
+
+type TLS struct {
+	CertFile       string   `json:"cert_file"`
+	KeyFile        string   `json:"key_file"`
+	MinVersion     string   `json:"min_version"`
+	CipherSuites   []string `json:"cipher_suites"`
+	ClientCAFile   string   `json:"client_ca_file"`
+	ClientAuth     string   `json:"client_auth"`
+	ReloadInterval Duration `json:"reload_interval"`
+}
+
+func (t TLS) Enabled() bool {
+	return len(t.CertFile) > 0
 }
 
 type Database struct {
@@ -11,12 +75,107 @@ type Database struct {
 }
 
 type Kafka struct {
-	Brokers []string `json:"brokers"`
-	Topics  Topics   `json:"topics"`
+	Driver         string              `json:"driver"`
+	Memory         KafkaMemory         `json:"memory"`
+	Brokers        []string            `json:"brokers"`
+	TLS            KafkaTLS            `json:"tls"`
+	SASL           KafkaSASL           `json:"sasl"`
+	Topics         Topics              `json:"topics"`
+	Subscriptions  []Subscription      `json:"subscriptions"`
+	Consumer       KafkaConsumer       `json:"consumer"`
+	Producer       KafkaProducer       `json:"producer"`
+	SchemaRegistry KafkaSchemaRegistry `json:"schema_registry"`
+}
+
+// KafkaSchemaRegistry реестр схем для сообщений в формате Confluent. Dir задает локальный каталог схем вместо URL
+type KafkaSchemaRegistry struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Dir      string `json:"dir"`
+}
+
+// KafkaProducer настройки надежности продюсеров. Нулевые значения оставляют умолчания kafka-go
+type KafkaProducer struct {
+	RequiredAcks string            `json:"required_acks"`
+	Compression  string            `json:"compression"`
+	Balancer     string            `json:"balancer"`
+	MaxAttempts  int               `json:"max_attempts"`
+	BackoffMin   Duration          `json:"backoff_min"`
+	BackoffMax   Duration          `json:"backoff_max"`
+	WriteTimeout Duration          `json:"write_timeout"`
+	Headers      map[string]string `json:"headers"`
+}
+
+// KafkaMemory настройки брокера в памяти (driver: memory)
+type KafkaMemory struct {
+	Partitions int `json:"partitions"`
+}
+
+type KafkaTLS struct {
+	Enabled            bool   `json:"enabled"`
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+type KafkaSASL struct {
+	Mechanism    string `json:"mechanism"`
+	Username     string `json:"username"`
+	UsernameFile string `json:"username_file"`
+	Password     string `json:"password"`
+	PasswordFile string `json:"password_file"`
+}
+
+// Subscription привязывает топик к типу сообщений для сообщений без заголовка type
+type Subscription struct {
+	Topic string `json:"topic"`
+	Type  string `json:"type"`
+}
+
+type KafkaConsumer struct {
+	GroupId        string        `json:"group_id"`
+	StartOffset    string        `json:"start_offset"`
+	CommitInterval Duration      `json:"commit_interval"`
+	Retry          KafkaRetry    `json:"retry"`
+	Workers        int           `json:"workers"`
+	MaxInFlight    int           `json:"max_in_flight"`
+	Batch          KafkaBatch    `json:"batch"`
+	Deduplication  Deduplication `json:"deduplication"`
+	Pending        Pending       `json:"pending"`
+}
+
+// KafkaBatch включает пакетную обработку при Size больше 1
+type KafkaBatch struct {
+	Size int      `json:"size"`
+	Wait Duration `json:"wait"`
+}
+
+type Deduplication struct {
+	TTL             Duration `json:"ttl"`
+	CleanupInterval Duration `json:"cleanup_interval"`
+}
+
+// Pending билеты пользователей, которых еще нет в базе, ждут их не дольше TTL
+type Pending struct {
+	TTL             Duration `json:"ttl"`
+	CleanupInterval Duration `json:"cleanup_interval"`
+}
+
+type KafkaRetry struct {
+	MaxAttempts    int      `json:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
 }
 
 type Topics struct {
-	UserTickets string `json:"user_tickets"`
+	UserTickets           string `json:"user_tickets"`
+	UserTicketsDeadLetter string `json:"user_tickets_dead_letter"`
+	TicketEvents          string `json:"ticket_events"`
+	BookingRejected       string `json:"booking_rejected"`
+	UserEvents            string `json:"user_events"`
+	UserState             string `json:"user_state"`
 }
 
 func NewSettings() (Settings, error) {
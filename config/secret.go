@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadSecret возвращает значение из файла file, если он задан, иначе value.
+// Так пароли можно монтировать секретами, не записывая их в JSON
+func ReadSecret(value, file string) (string, error) {
+	if len(file) == 0 {
+		return value, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret %s: %w", file, err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	integrityViolationClass  = "23"
+	foreignKeyViolationCode  = "23503"
+	uniqueViolationCode      = "23505"
+	checkViolationCode       = "23514"
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+)
+
+// IsIntegrityViolation сообщает, что запрос нарушил ограничение целостности и повтор не поможет
+func IsIntegrityViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, integrityViolationClass)
+}
+
+// IsForeignKeyViolation сообщает, что запрос сослался на несуществующую строку
+func IsForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode
+}
+
+// IsUniqueViolation сообщает, что такая строка уже существует
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
+
+// IsCheckViolation сообщает, что значение не прошло проверку CHECK
+func IsCheckViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == checkViolationCode
+}
+
+// IsRetryable сообщает, что транзакция проиграла параллельной из-за сериализации или взаимной блокировки
+// и ее можно повторить целиком
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == serializationFailureCode || pgErr.Code == deadlockDetectedCode)
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const listenRetryDelay = 5 * time.Second
+
+// Listen слушает канал postgres LISTEN/NOTIFY на отдельном соединении пула и вызывает handle с payload уведомлений,
+// пока не отменен ctx. Оборванное соединение переподключается, а subscribed вызывается после каждой подписки:
+// уведомления, отправленные без подписки, потеряны
+func Listen(ctx context.Context, database *sqlx.DB, log *zap.Logger, channel string, subscribed func(), handle func(payload string)) {
+	for {
+		err := listen(ctx, database, channel, subscribed, handle)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Error("postgres listener stopped", zap.String("channel", channel), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func listen(ctx context.Context, database *sqlx.DB, channel string, subscribed func(), handle func(payload string)) error {
+	conn, err := database.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get connection: %w", err)
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("listen requires a pgx connection")
+		}
+
+		pgxConn := stdlibConn.Conn()
+		if _, err := pgxConn.Exec(ctx, "listen "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return fmt.Errorf("could not listen: %w", err)
+		}
+
+		defer func() {
+			_, _ = pgxConn.Exec(context.WithoutCancel(ctx), "unlisten *")
+		}()
+
+		subscribed()
+
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return fmt.Errorf("could not wait for notification: %w", err)
+			}
+
+			handle(notification.Payload)
+		}
+	})
+}
@@ -0,0 +1,13 @@
+-- +goose Up
+create table if not exists processed_messages
+(
+    consumer     text        not null,
+    message_id   text        not null,
+    processed_at timestamptz not null default now(),
+    constraint pk_processed_messages primary key (consumer, message_id)
+);
+
+create index if not exists processed_messages_processed_at_idx on processed_messages (processed_at);
+
+-- +goose Down
+drop table if exists processed_messages;
\ No newline at end of file
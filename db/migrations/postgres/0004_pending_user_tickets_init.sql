@@ -0,0 +1,14 @@
+-- +goose Up
+create table if not exists pending_user_tickets
+(
+    user_id    uuid        not null,
+    ticket_id  varchar(48) not null,
+    message_id text        not null,
+    created_at timestamptz not null default now(),
+    constraint pk_pending_user_tickets primary key (user_id, ticket_id)
+);
+
+create index if not exists pending_user_tickets_created_at_idx on pending_user_tickets (created_at);
+
+-- +goose Down
+drop table if exists pending_user_tickets;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- +goose Up
+create table if not exists ticket_transfers
+(
+    id             uuid primary key     default gen_random_uuid(),
+    ticket_id      varchar(48) not null,
+    from_user_id   uuid        not null,
+    to_user_id     uuid        not null,
+    initiated_by   text        not null,
+    transferred_at timestamptz not null default now()
+);
+
+create index if not exists ticket_transfers_ticket_id_idx on ticket_transfers (ticket_id);
+
+-- +goose Down
+drop table if exists ticket_transfers;
\ No newline at end of file
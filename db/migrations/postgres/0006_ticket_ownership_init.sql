@@ -0,0 +1,60 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+create table if not exists ticket_ownership_conflicts
+(
+    id            bigserial primary key,
+    ticket_id     varchar(48) not null,
+    user_id       uuid        not null,
+    owner_user_id uuid        not null,
+    message_id    text        not null default '',
+    source        text        not null,
+    detected_at   timestamptz not null default now()
+);
+
+create index if not exists ticket_ownership_conflicts_ticket_id_idx on ticket_ownership_conflicts (ticket_id);
+
+-- дубли не удаляются: они записываются в карантин с source = 'migration', а миграция останавливается,
+-- пока в user_tickets вручную не оставят одного владельца каждого билета. owner_user_id - только кандидат,
+-- к которому билет, насколько это можно восстановить по ctid, был привязан первым
+with owners as (
+    select ticket_id,
+           user_id,
+           first_value(user_id) over (partition by ticket_id order by ctid) as first_user_id,
+           count(*) over (partition by ticket_id)                          as owners
+    from user_tickets
+)
+insert
+into ticket_ownership_conflicts (ticket_id, user_id, owner_user_id, source)
+select o.ticket_id, o.user_id, o.first_user_id, 'migration'
+from owners o
+where o.owners > 1
+  and o.user_id <> o.first_user_id
+  and not exists(select 1
+                 from ticket_ownership_conflicts c
+                 where c.source = 'migration'
+                   and c.ticket_id = o.ticket_id
+                   and c.user_id = o.user_id);
+
+-- +goose StatementBegin
+do
+$$
+    declare
+        duplicates int;
+    begin
+        select count(*)
+        into duplicates
+        from (select ticket_id from user_tickets group by ticket_id having count(*) > 1) d;
+
+        if duplicates > 0 then
+            raise exception '% tickets have several owners: see ticket_ownership_conflicts with source migration and keep one owner per ticket in user_tickets', duplicates;
+        end if;
+    end
+$$;
+-- +goose StatementEnd
+
+create unique index if not exists user_tickets_ticket_id_uidx on user_tickets (ticket_id);
+
+-- +goose Down
+drop index if exists user_tickets_ticket_id_uidx;
+
+drop table if exists ticket_ownership_conflicts;
\ No newline at end of file
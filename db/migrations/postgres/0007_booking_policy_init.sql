@@ -0,0 +1,27 @@
+-- +goose Up
+alter table users
+    add column if not exists status     text    not null default 'active',
+    add column if not exists verified   boolean not null default false,
+    add column if not exists birth_date date;
+
+alter table user_tickets
+    add column if not exists event_id varchar(48) not null default '';
+
+alter table pending_user_tickets
+    add column if not exists event_id varchar(48) not null default '';
+
+create index if not exists user_tickets_user_id_event_id_idx on user_tickets (user_id, event_id);
+
+-- +goose Down
+drop index if exists user_tickets_user_id_event_id_idx;
+
+alter table pending_user_tickets
+    drop column if exists event_id;
+
+alter table user_tickets
+    drop column if exists event_id;
+
+alter table users
+    drop column if exists birth_date,
+    drop column if exists verified,
+    drop column if exists status;
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- +goose Up
+create table if not exists outbox
+(
+    id              bigserial primary key,
+    event_id        uuid        not null default gen_random_uuid(),
+    aggregate_id    text        not null,
+    event_type      text        not null,
+    payload         jsonb       not null,
+    created_at      timestamptz not null default now(),
+    attempts        int         not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    last_error      text
+);
+
+create index if not exists outbox_aggregate_id_idx on outbox (aggregate_id, id);
+
+-- +goose Down
+drop table if exists outbox;
\ No newline at end of file
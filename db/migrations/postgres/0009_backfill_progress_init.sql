@@ -0,0 +1,10 @@
+-- +goose Up
+create table if not exists backfill_progress
+(
+    name         text primary key,
+    last_user_id uuid        not null default '00000000-0000-0000-0000-000000000000',
+    updated_at   timestamptz not null default now()
+);
+
+-- +goose Down
+drop table if exists backfill_progress;
\ No newline at end of file
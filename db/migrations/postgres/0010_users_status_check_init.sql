@@ -0,0 +1,7 @@
+-- +goose Up
+alter table users
+    add constraint users_status_check check (status in ('active', 'suspended')) not valid;
+
+-- +goose Down
+alter table users
+    drop constraint if exists users_status_check;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- +goose Up
+-- возрастное ограничение бронирования нужно, чтобы проверить политику при появлении пользователя
+alter table pending_user_tickets
+    add column if not exists min_age int not null default 0;
+
+-- +goose Down
+alter table pending_user_tickets
+    drop column if exists min_age;
\ No newline at end of file
@@ -0,0 +1,17 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DbOutboxEvent struct {
+	Id          int64     `db:"id"`
+	EventId     uuid.UUID `db:"event_id"`
+	AggregateId string    `db:"aggregate_id"`
+	EventType   string    `db:"event_type"`
+	Payload     []byte    `db:"payload"`
+	CreatedAt   time.Time `db:"created_at"`
+	Attempts    int       `db:"attempts"`
+}
@@ -0,0 +1,82 @@
+package outbox
+
+import (
+	"maps"
+	"time"
+	"user-service/kafka"
+)
+
+const (
+	defaultBatchSize  = 100
+	defaultBackoffMin = time.Second
+	defaultBackoffMax = 5 * time.Minute
+)
+
+type RelayOptions struct {
+	BatchSize  int
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	State      kafka.Producer
+	Routes     map[string]kafka.Producer
+}
+
+type RelayOption func(o RelayOptions) RelayOptions
+
+func newRelayOptions(options []RelayOption) RelayOptions {
+	o := RelayOptions{
+		BatchSize:  defaultBatchSize,
+		BackoffMin: defaultBackoffMin,
+		BackoffMax: defaultBackoffMax,
+	}
+	for _, option := range options {
+		o = option(o)
+	}
+
+	return o
+}
+
+// WithBatchSize ограничивает число событий, которые relay забирает за одну транзакцию
+func WithBatchSize(size int) RelayOption {
+	return func(o RelayOptions) RelayOptions {
+		if size > 0 {
+			o.BatchSize = size
+		}
+
+		return o
+	}
+}
+
+// WithBackoff задает задержку повторной публикации: она удваивается с каждой попыткой от min до max
+func WithBackoff(min, max time.Duration) RelayOption {
+	return func(o RelayOptions) RelayOptions {
+		if min > 0 {
+			o.BackoffMin = min
+		}
+		if max > 0 {
+			o.BackoffMax = max
+		}
+
+		return o
+	}
+}
+
+// WithRoute отправляет события типа eventType в producer вместо продюсера relay, например события билетов в их топик
+func WithRoute(eventType string, producer kafka.Producer) RelayOption {
+	return func(o RelayOptions) RelayOptions {
+		o.Routes = maps.Clone(o.Routes)
+		if o.Routes == nil {
+			o.Routes = make(map[string]kafka.Producer)
+		}
+
+		o.Routes[eventType] = producer
+		return o
+	}
+}
+
+// WithState включает публикацию текущего состояния пользователей в compacted топик с ключом по id пользователя
+func WithState(producer kafka.Producer) RelayOption {
+	return func(o RelayOptions) RelayOptions {
+		o.State = producer
+		return o
+	}
+}
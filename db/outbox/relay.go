@@ -0,0 +1,228 @@
+package outbox
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"time"
+	"user-service/kafka"
+	"user-service/pkg"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const eventVersion = 1
+
+var metrics = expvar.NewMap("outbox")
+
+//go:embed sql/lock_outbox_events.sql
+var lockOutboxEventsSql string
+
+//go:embed sql/delete_outbox_events.sql
+var deleteOutboxEventsSql string
+
+//go:embed sql/fail_outbox_event.sql
+var failOutboxEventSql string
+
+// Relay публикует события из outbox в Kafka. Забирает только первое неопубликованное событие каждого агрегата
+// (пользователя или билета), поэтому порядок его событий сохраняется и при нескольких репликах:
+// строки блокируются FOR UPDATE SKIP LOCKED
+type Relay struct {
+	db       *sqlx.DB
+	producer kafka.Producer
+	log      *zap.Logger
+	options  RelayOptions
+}
+
+func NewRelay(db *sqlx.DB, producer kafka.Producer, log *zap.Logger, options ...RelayOption) *Relay {
+	return &Relay{
+		db:       db,
+		producer: producer,
+		log:      log,
+		options:  newRelayOptions(options),
+	}
+}
+
+// Publish публикует готовые к отправке события, пока они не закончатся. Возвращает число опубликованных событий
+func (r *Relay) Publish(ctx context.Context) (int, error) {
+	var published int
+	for {
+		count, full, err := r.publishBatch(ctx)
+		published += count
+		if err != nil {
+			r.log.Error("could not publish outbox events", zap.Error(err))
+			return published, err
+		}
+		if !full {
+			return published, nil
+		}
+	}
+}
+
+// publishBatch публикует пачку событий в одной транзакции. Неудачная публикация откладывает событие,
+// а вместе с ним и следующие события того же агрегата
+func (r *Relay) publishBatch(ctx context.Context) (published int, full bool, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	events := make([]DbOutboxEvent, 0, r.options.BatchSize)
+	if err = tx.SelectContext(ctx, &events, lockOutboxEventsSql, r.options.BatchSize); err != nil {
+		return 0, false, fmt.Errorf("could not lock outbox events: %w", err)
+	}
+
+	done := make([]int64, 0, len(events))
+	for i, publishErr := range r.publish(ctx, events) {
+		event := events[i]
+		if publishErr != nil {
+			metrics.Add("failed", 1)
+			r.log.Error("could not publish outbox event",
+				zap.Int64("id", event.Id),
+				zap.String("event_type", event.EventType),
+				zap.String("aggregate_id", event.AggregateId),
+				zap.Int("attempts", event.Attempts+1),
+				zap.Error(publishErr))
+
+			next := time.Now().Add(r.backoff(event.Attempts + 1))
+			if _, err = tx.ExecContext(ctx, failOutboxEventSql, event.Id, next, publishErr.Error()); err != nil {
+				return 0, false, fmt.Errorf("could not postpone outbox event %d: %w", event.Id, err)
+			}
+
+			continue
+		}
+
+		done = append(done, event.Id)
+	}
+
+	if len(done) > 0 {
+		if _, err = tx.ExecContext(ctx, deleteOutboxEventsSql, done); err != nil {
+			return 0, false, fmt.Errorf("could not delete outbox events: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	metrics.Add("published", int64(len(done)))
+
+	return len(done), len(events) == r.options.BatchSize, nil
+}
+
+// stateEvents события, меняющие состояние пользователя в compacted топике
+var stateEvents = map[string]bool{
+	pkg.UserCreatedType:  true,
+	pkg.UserUpdatedType:  true,
+	pkg.UserDeletedType:  true,
+	pkg.UserSnapshotType: true,
+}
+
+// publish отправляет события в топики их типов, по одной записи на продюсер, а затем состояния пользователей
+// из отправленных событий в топик состояния. Возвращает ошибки по индексам events.
+// Если состояние отправить не удалось, при повторе событие уйдет еще раз с тем же id конверта
+func (r *Relay) publish(ctx context.Context, events []DbOutboxEvent) []error {
+	errs := make([]error, len(events))
+
+	batches := make(map[kafka.Producer]*batch)
+	for i, event := range events {
+		if event.EventType == pkg.UserSnapshotType {
+			continue
+		}
+
+		message, err := kafka.NewEnvelopeMessageAt(event.AggregateId, event.EventId.String(), event.CreatedAt,
+			event.EventType, eventVersion, pkg.ServiceName, json.RawMessage(event.Payload))
+		if err != nil {
+			errs[i] = fmt.Errorf("could not create message: %w", err)
+			continue
+		}
+
+		producer, ok := r.options.Routes[event.EventType]
+		if !ok {
+			producer = r.producer
+		}
+
+		if batches[producer] == nil {
+			batches[producer] = &batch{}
+		}
+		batches[producer].add(i, message)
+	}
+
+	for producer, b := range batches {
+		for i, err := range b.produce(ctx, producer) {
+			if err != nil {
+				errs[b.indexes[i]] = err
+			}
+		}
+	}
+
+	if r.options.State == nil {
+		return errs
+	}
+
+	var state batch
+	for i, event := range events {
+		if errs[i] == nil && stateEvents[event.EventType] {
+			state.add(i, stateMessage(event))
+		}
+	}
+	for i, err := range state.produce(ctx, r.options.State) {
+		if err != nil {
+			errs[state.indexes[i]] = fmt.Errorf("could not publish user state: %w", err)
+		}
+	}
+
+	return errs
+}
+
+// batch сообщения одного продюсера и индексы их событий в пачке relay
+type batch struct {
+	indexes  []int
+	messages []kafka.Message
+}
+
+func (b *batch) add(index int, message kafka.Message) {
+	b.indexes = append(b.indexes, index)
+	b.messages = append(b.messages, message)
+}
+
+// produce отправляет сообщения одной записью и возвращает ошибки по сообщениям
+func (b *batch) produce(ctx context.Context, producer kafka.Producer) []error {
+	if len(b.messages) == 0 {
+		return nil
+	}
+
+	return kafka.ProduceErrors(producer.Produce(ctx, b.messages...), len(b.messages))
+}
+
+// stateMessage последнее состояние пользователя для compacted топика. Удаление публикуется tombstone без значения
+func stateMessage(event DbOutboxEvent) kafka.Message {
+	message := kafka.Message{
+		Key:  []byte(event.AggregateId),
+		Time: event.CreatedAt,
+	}
+	if event.EventType != pkg.UserDeletedType {
+		message.Value = event.Payload
+	}
+
+	return message
+}
+
+// backoff задержка перед попыткой attempt: удваивается от BackoffMin и ограничена BackoffMax
+func (r *Relay) backoff(attempt int) time.Duration {
+	delay := r.options.BackoffMin
+	for i := 1; i < attempt && delay < r.options.BackoffMax; i++ {
+		delay *= 2
+	}
+
+	return min(delay, r.options.BackoffMax)
+}
@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"user-service/kafka"
+	"user-service/pkg"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// countingProducer считает записи и может провалить сообщения с заданными ключами
+type countingProducer struct {
+	kafka.Producer
+
+	writes int
+	failed map[string]bool
+}
+
+func (p *countingProducer) Produce(ctx context.Context, messages ...kafka.Message) error {
+	p.writes++
+
+	errs := make(kafka.WriteErrors, len(messages))
+	sent := make([]kafka.Message, 0, len(messages))
+	for i, message := range messages {
+		if p.failed[string(message.Key)] {
+			errs[i] = errors.New("broker is unavailable")
+			continue
+		}
+
+		sent = append(sent, message)
+	}
+
+	if err := p.Producer.Produce(ctx, sent...); err != nil {
+		return err
+	}
+	if len(sent) < len(messages) {
+		return errs
+	}
+
+	return nil
+}
+
+func outboxEvent(id int64, aggregateId, eventType string) DbOutboxEvent {
+	return DbOutboxEvent{
+		Id:          id,
+		EventId:     uuid.New(),
+		AggregateId: aggregateId,
+		EventType:   eventType,
+		Payload:     []byte(`{}`),
+		CreatedAt:   time.Now(),
+	}
+}
+
+func TestRelayPublishWritesOncePerProducer(t *testing.T) {
+	broker := kafka.NewMemoryKafka(1)
+	users := &countingProducer{Producer: broker.Producer("users")}
+	tickets := &countingProducer{Producer: broker.Producer("tickets"), failed: map[string]bool{"t2": true}}
+	state := &countingProducer{Producer: broker.Producer("state")}
+
+	relay := NewRelay(nil, users, zap.NewNop(), WithState(state), WithRoute(pkg.TicketTransferredType, tickets))
+
+	events := []DbOutboxEvent{
+		outboxEvent(1, "u1", pkg.UserCreatedType),
+		outboxEvent(2, "t1", pkg.TicketTransferredType),
+		outboxEvent(3, "u2", pkg.UserUpdatedType),
+		outboxEvent(4, "t2", pkg.TicketTransferredType),
+		outboxEvent(5, "u3", pkg.UserSnapshotType),
+	}
+
+	errs := relay.publish(context.Background(), events)
+	for i, err := range errs {
+		if (err != nil) != (events[i].AggregateId == "t2") {
+			t.Fatalf("event %d: unexpected error %v", events[i].Id, err)
+		}
+	}
+
+	if users.writes != 1 || tickets.writes != 1 || state.writes != 1 {
+		t.Fatalf("got %d, %d and %d writes, want one per producer", users.writes, tickets.writes, state.writes)
+	}
+
+	counts := map[string]int{"users": 2, "tickets": 1, "state": 3}
+	for topic, count := range counts {
+		if messages := broker.Messages(topic); len(messages) != count {
+			t.Fatalf("got %d messages in %s, want %d", len(messages), topic, count)
+		}
+	}
+}
+
+func TestRelayPublishSkipsStateOfFailedEvent(t *testing.T) {
+	broker := kafka.NewMemoryKafka(1)
+	users := &countingProducer{Producer: broker.Producer("users"), failed: map[string]bool{"u1": true}}
+	state := &countingProducer{Producer: broker.Producer("state"), failed: map[string]bool{"u2": true}}
+
+	relay := NewRelay(nil, users, zap.NewNop(), WithState(state))
+
+	errs := relay.publish(context.Background(), []DbOutboxEvent{
+		outboxEvent(1, "u1", pkg.UserCreatedType),
+		outboxEvent(2, "u2", pkg.UserCreatedType),
+		outboxEvent(3, "u3", pkg.UserCreatedType),
+	})
+	if errs[0] == nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if messages := broker.Messages("state"); len(messages) != 1 || string(messages[0].Key) != "u3" {
+		t.Fatalf("unexpected state messages: %v", messages)
+	}
+}
@@ -0,0 +1,3 @@
+delete
+from outbox
+where id = any ($1);
\ No newline at end of file
@@ -0,0 +1,12 @@
+select o.id           as id,
+       o.event_id     as event_id,
+       o.aggregate_id as aggregate_id,
+       o.event_type   as event_type,
+       o.payload      as payload,
+       o.created_at   as created_at,
+       o.attempts     as attempts
+from outbox o
+where o.next_attempt_at <= now()
+  and not exists(select 1 from outbox p where p.aggregate_id = o.aggregate_id and p.id < o.id)
+order by o.id
+limit $1 for update skip locked;
\ No newline at end of file
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultTxAttempts = 3
+	defaultTxBackoff  = 20 * time.Millisecond
+)
+
+// Querier общие методы *sqlx.DB и *sqlx.Tx, через которые репозитории выполняют запросы
+type Querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error)
+}
+
+type txKey struct{}
+
+type TxOptions struct {
+	Isolation   sql.IsolationLevel
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+type TxOption func(o TxOptions) TxOptions
+
+func newTxOptions(options []TxOption) TxOptions {
+	o := TxOptions{
+		Isolation:   sql.LevelDefault,
+		MaxAttempts: defaultTxAttempts,
+		Backoff:     defaultTxBackoff,
+	}
+	for _, option := range options {
+		o = option(o)
+	}
+
+	return o
+}
+
+// WithIsolation задает уровень изоляции транзакции
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o TxOptions) TxOptions {
+		o.Isolation = level
+		return o
+	}
+}
+
+// WithTxRetry задает число попыток транзакции и паузу перед повтором, которая растет с каждой попыткой
+func WithTxRetry(attempts int, backoff time.Duration) TxOption {
+	return func(o TxOptions) TxOptions {
+		if attempts > 0 {
+			o.MaxAttempts = attempts
+		}
+		if backoff > 0 {
+			o.Backoff = backoff
+		}
+
+		return o
+	}
+}
+
+// WithTx выполняет fn в транзакции, которая передается дальше через ctx: запросы через Conn(ctx, ...) идут в нее.
+// Если в ctx уже есть транзакция, fn присоединяется к ней, а фиксацию, откат и повторы выполняет внешний WithTx,
+// опции вложенного вызова не действуют. При ошибке сериализации или взаимной блокировке fn повторяется целиком,
+// поэтому fn не должна делать ничего, кроме запросов в базу
+func WithTx(ctx context.Context, database *sqlx.DB, fn func(ctx context.Context) error, options ...TxOption) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+
+	o := newTxOptions(options)
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, database, o.Isolation, fn)
+		if err == nil || !IsRetryable(err) || attempt >= o.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not retry transaction: %w", ctx.Err())
+		case <-time.After(o.Backoff * time.Duration(attempt)):
+		}
+	}
+}
+
+// Conn возвращает транзакцию из ctx, а вне транзакции - database
+func Conn(ctx context.Context, database *sqlx.DB) Querier {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+
+	return database
+}
+
+func runTx(ctx context.Context, database *sqlx.DB, isolation sql.IsolationLevel, fn func(ctx context.Context) error) (err error) {
+	tx, err := database.BeginTxx(ctx, &sql.TxOptions{Isolation: isolation})
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
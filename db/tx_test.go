@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDatabase драйвер database/sql, который только считает транзакции и может провалить фиксацию
+type fakeDatabase struct {
+	mutex      sync.Mutex
+	isolations []driver.IsolationLevel
+	commits    int
+	rollbacks  int
+	commitErrs []error
+}
+
+func newFakeDatabase(commitErrs ...error) (*fakeDatabase, *sqlx.DB) {
+	database := &fakeDatabase{commitErrs: commitErrs}
+
+	return database, sqlx.NewDb(sql.OpenDB(database), "pgx")
+}
+
+func (d *fakeDatabase) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{database: d}, nil
+}
+
+func (d *fakeDatabase) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+func (d *fakeDatabase) stats() (int, int, int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return len(d.isolations), d.commits, d.rollbacks
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake driver opens connections only through connector")
+}
+
+type fakeConn struct {
+	database *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver does not run queries")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(_ context.Context, options driver.TxOptions) (driver.Tx, error) {
+	c.database.mutex.Lock()
+	defer c.database.mutex.Unlock()
+
+	c.database.isolations = append(c.database.isolations, options.Isolation)
+
+	return &fakeTx{database: c.database}, nil
+}
+
+type fakeTx struct {
+	database *fakeDatabase
+}
+
+func (t *fakeTx) Commit() error {
+	t.database.mutex.Lock()
+	defer t.database.mutex.Unlock()
+
+	t.database.commits++
+	if len(t.database.commitErrs) == 0 {
+		return nil
+	}
+
+	err := t.database.commitErrs[0]
+	t.database.commitErrs = t.database.commitErrs[1:]
+
+	return err
+}
+
+func (t *fakeTx) Rollback() error {
+	t.database.mutex.Lock()
+	defer t.database.mutex.Unlock()
+
+	t.database.rollbacks++
+
+	return nil
+}
+
+func pgError(code string) error {
+	return &pgconn.PgError{Code: code}
+}
+
+func TestWithTxRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		errs       []error
+		commitErrs []error
+		calls      int
+		commits    int
+		rollbacks  int
+		err        string
+	}{
+		{name: "success", calls: 1, commits: 1},
+		{name: "serialization failure", errs: []error{pgError(serializationFailureCode)}, calls: 2, commits: 1, rollbacks: 1},
+		{name: "deadlock", errs: []error{pgError(deadlockDetectedCode)}, calls: 2, commits: 1, rollbacks: 1},
+		{
+			name:       "serialization failure on commit",
+			commitErrs: []error{pgError(serializationFailureCode)},
+			calls:      2,
+			commits:    2,
+		},
+		{
+			name:      "not retryable",
+			errs:      []error{pgError(uniqueViolationCode)},
+			calls:     1,
+			rollbacks: 1,
+			err:       uniqueViolationCode,
+		},
+		{
+			name: "attempts exhausted",
+			errs: []error{
+				pgError(serializationFailureCode),
+				pgError(deadlockDetectedCode),
+				pgError(serializationFailureCode),
+			},
+			calls:     3,
+			rollbacks: 3,
+			err:       serializationFailureCode,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, database := newFakeDatabase(test.commitErrs...)
+
+			calls := 0
+			err := WithTx(context.Background(), database, func(ctx context.Context) error {
+				calls++
+				if calls <= len(test.errs) {
+					return test.errs[calls-1]
+				}
+
+				return nil
+			}, WithTxRetry(3, time.Millisecond))
+
+			var pgErr *pgconn.PgError
+			switch {
+			case len(test.err) == 0 && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case len(test.err) > 0 && (!errors.As(err, &pgErr) || pgErr.Code != test.err):
+				t.Fatalf("got error %v, want code %s", err, test.err)
+			}
+
+			begins, commits, rollbacks := fake.stats()
+			if calls != test.calls || begins != test.calls || commits != test.commits || rollbacks != test.rollbacks {
+				t.Fatalf("got %d calls, %d begins, %d commits, %d rollbacks, want %d calls, %d commits, %d rollbacks",
+					calls, begins, commits, rollbacks, test.calls, test.commits, test.rollbacks)
+			}
+		})
+	}
+}
+
+func TestWithTxStopsRetryOnCancel(t *testing.T) {
+	fake, database := newFakeDatabase()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := WithTx(ctx, database, func(ctx context.Context) error {
+		cancel()
+		return pgError(serializationFailureCode)
+	}, WithTxRetry(3, time.Hour))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	if begins, _, _ := fake.stats(); begins != 1 {
+		t.Fatalf("got %d begins, want 1", begins)
+	}
+}
+
+func TestWithTxJoinsOuterTransaction(t *testing.T) {
+	fake, database := newFakeDatabase()
+
+	innerCalls := 0
+	err := WithTx(context.Background(), database, func(ctx context.Context) error {
+		outer := Conn(ctx, database)
+
+		return WithTx(ctx, database, func(ctx context.Context) error {
+			innerCalls++
+			if Conn(ctx, database) != outer {
+				t.Errorf("nested call got another connection")
+			}
+
+			return nil
+		}, WithIsolation(sql.LevelSerializable))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if innerCalls != 1 {
+		t.Fatalf("got %d nested calls, want 1", innerCalls)
+	}
+
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if len(fake.isolations) != 1 || fake.isolations[0] != driver.IsolationLevel(sql.LevelDefault) || fake.commits != 1 {
+		t.Fatalf("got isolations %v and %d commits, want one default transaction", fake.isolations, fake.commits)
+	}
+}
+
+func TestWithTxNestedErrorRetriesOuter(t *testing.T) {
+	fake, database := newFakeDatabase()
+
+	calls := 0
+	err := WithTx(context.Background(), database, func(ctx context.Context) error {
+		calls++
+
+		return WithTx(ctx, database, func(ctx context.Context) error {
+			if calls == 1 {
+				return pgError(deadlockDetectedCode)
+			}
+
+			return nil
+		})
+	}, WithTxRetry(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if begins, commits, rollbacks := fake.stats(); calls != 2 || begins != 2 || commits != 1 || rollbacks != 1 {
+		t.Fatalf("got %d calls, %d begins, %d commits, %d rollbacks", calls, begins, commits, rollbacks)
+	}
+}
+
+func TestWithTxIsolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []TxOption
+		level   sql.IsolationLevel
+	}{
+		{name: "default", level: sql.LevelDefault},
+		{name: "repeatable read", options: []TxOption{WithIsolation(sql.LevelRepeatableRead)}, level: sql.LevelRepeatableRead},
+		{name: "serializable", options: []TxOption{WithIsolation(sql.LevelSerializable)}, level: sql.LevelSerializable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, database := newFakeDatabase()
+
+			err := WithTx(context.Background(), database, func(context.Context) error {
+				return nil
+			}, test.options...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			fake.mutex.Lock()
+			defer fake.mutex.Unlock()
+
+			if len(fake.isolations) != 1 || fake.isolations[0] != driver.IsolationLevel(test.level) {
+				t.Fatalf("got isolations %v, want %v", fake.isolations, test.level)
+			}
+		})
+	}
+}
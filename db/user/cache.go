@@ -0,0 +1,242 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"sync"
+	"time"
+	"user-service/cache"
+	"user-service/db"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+// UserChangedChannel канал postgres NOTIFY, в который при фиксации изменения пользователя приходит его id
+const UserChangedChannel = "user_changed"
+
+//go:embed sql/notify_user_changed.sql
+var notifyUserChangedSql string
+
+func notifyUserChanged(ctx context.Context, tx db.Querier, id uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, notifyUserChangedSql, UserChangedChannel, id)
+
+	return err
+}
+
+type cachedUser struct {
+	user  DbUser
+	found bool
+}
+
+// CachedRepository кеширует GetUserById, в том числе отсутствие пользователя. Одновременные промахи по одному id
+// выполняют один запрос. Запись сбрасывается при изменении пользователя через этот репозиторий, а изменения
+// на других репликах приходят через HandleNotification из канала UserChangedChannel. В WithTx кеш не используется:
+// fn получает репозиторий без кеша, который не увидит незафиксированных изменений транзакции, а измененные в fn
+// пользователи сбрасываются после ее завершения
+type CachedRepository struct {
+	Repository
+
+	cache       *cache.LRU[uuid.UUID, cachedUser]
+	group       *singleflight.Group
+	mutex       *sync.Mutex
+	loading     map[uuid.UUID]bool
+	purges      uint64
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+// NewCachedRepository создает кеш на size пользователей. Нулевой negativeTTL отключает кеширование отсутствия
+func NewCachedRepository(repository Repository, size int, ttl, negativeTTL time.Duration) *CachedRepository {
+	return &CachedRepository{
+		Repository:  repository,
+		cache:       cache.NewLRU[uuid.UUID, cachedUser](size),
+		group:       &singleflight.Group{},
+		mutex:       &sync.Mutex{},
+		loading:     make(map[uuid.UUID]bool),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+func (r *CachedRepository) GetUserById(ctx context.Context, id uuid.UUID) (DbUser, error) {
+	if cached, ok := r.cache.Get(id); ok {
+		if !cached.found {
+			return DbUser{}, notFound(sql.ErrNoRows)
+		}
+
+		return cached.user, nil
+	}
+
+	// запрос выполняется без отмены ctx первого вызова: его результат ждут и другие вызовы с тем же id,
+	// а каждый вызов перестает ждать при отмене своего ctx
+	loaded := r.group.DoChan(id.String(), func() (any, error) {
+		purges := r.startLoad(id)
+
+		user, err := r.Repository.GetUserById(context.WithoutCancel(ctx), id)
+		switch {
+		case err == nil:
+			r.finishLoad(id, purges, &cachedUser{user: user, found: true}, r.ttl)
+		case errors.Is(err, ErrNotFound) && r.negativeTTL > 0:
+			r.finishLoad(id, purges, &cachedUser{}, r.negativeTTL)
+		default:
+			r.finishLoad(id, purges, nil, 0)
+		}
+
+		return user, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return DbUser{}, ctx.Err()
+	case result := <-loaded:
+		if result.Err != nil {
+			return DbUser{}, result.Err
+		}
+
+		return result.Val.(DbUser), nil
+	}
+}
+
+func (r *CachedRepository) AddUser(ctx context.Context, user DbUser) (uuid.UUID, error) {
+	id, err := r.Repository.AddUser(ctx, user)
+	if err == nil {
+		r.Invalidate(id)
+	}
+
+	return id, err
+}
+
+func (r *CachedRepository) UpdateUser(ctx context.Context, user DbUser) error {
+	err := r.Repository.UpdateUser(ctx, user)
+	r.Invalidate(user.Id)
+
+	return err
+}
+
+func (r *CachedRepository) UpdateUserVerification(ctx context.Context, verification DbUserVerification) error {
+	err := r.Repository.UpdateUserVerification(ctx, verification)
+	r.Invalidate(verification.Id)
+
+	return err
+}
+
+func (r *CachedRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	err := r.Repository.DeleteUser(ctx, id)
+	r.Invalidate(id)
+
+	return err
+}
+
+func (r *CachedRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repository Repository) error, options ...db.TxOption) error {
+	changed := &changedUsers{}
+
+	defer func() {
+		for _, id := range changed.ids {
+			r.Invalidate(id)
+		}
+	}()
+
+	return r.Repository.WithTx(ctx, func(ctx context.Context, repository Repository) error {
+		return fn(ctx, changedRepository{Repository: repository, changed: changed})
+	}, options...)
+}
+
+// Invalidate сбрасывает пользователя. Запрос этого пользователя, начатый до сброса, свой результат в кеш уже не положит
+func (r *CachedRepository) Invalidate(id uuid.UUID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.loading[id]; ok {
+		r.loading[id] = true
+	}
+	r.cache.Delete(id)
+}
+
+// InvalidateAll сбрасывает весь кеш, например после переподключения к каналу уведомлений
+func (r *CachedRepository) InvalidateAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.purges++
+	r.cache.Purge()
+}
+
+// HandleNotification сбрасывает пользователя из уведомления UserChangedChannel, а непонятное уведомление - весь кеш
+func (r *CachedRepository) HandleNotification(payload string) {
+	id, err := uuid.Parse(payload)
+	if err != nil {
+		r.InvalidateAll()
+		return
+	}
+
+	r.Invalidate(id)
+}
+
+func (r *CachedRepository) Stats() cache.Stats {
+	return r.cache.Stats()
+}
+
+// startLoad отмечает начало запроса пользователя и возвращает число полных сбросов на этот момент.
+// Запросы одного id не пересекаются: их объединяет singleflight
+func (r *CachedRepository) startLoad(id uuid.UUID) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.loading[id] = false
+
+	return r.purges
+}
+
+// finishLoad кладет результат запроса в кеш, только если с его начала не сбрасывались ни этот пользователь, ни весь кеш.
+// Пустой value только завершает запрос
+func (r *CachedRepository) finishLoad(id uuid.UUID, purges uint64, value *cachedUser, ttl time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	invalidated := r.loading[id]
+	delete(r.loading, id)
+
+	if value != nil && !invalidated && r.purges == purges {
+		r.cache.Set(id, *value, ttl)
+	}
+}
+
+type changedUsers struct {
+	ids []uuid.UUID
+}
+
+// changedRepository запоминает пользователей, измененных в транзакции CachedRepository.WithTx
+type changedRepository struct {
+	Repository
+	changed *changedUsers
+}
+
+func (r changedRepository) AddUser(ctx context.Context, user DbUser) (uuid.UUID, error) {
+	id, err := r.Repository.AddUser(ctx, user)
+	if err == nil {
+		r.changed.ids = append(r.changed.ids, id)
+	}
+
+	return id, err
+}
+
+func (r changedRepository) UpdateUser(ctx context.Context, user DbUser) error {
+	r.changed.ids = append(r.changed.ids, user.Id)
+
+	return r.Repository.UpdateUser(ctx, user)
+}
+
+func (r changedRepository) UpdateUserVerification(ctx context.Context, verification DbUserVerification) error {
+	r.changed.ids = append(r.changed.ids, verification.Id)
+
+	return r.Repository.UpdateUserVerification(ctx, verification)
+}
+
+func (r changedRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	r.changed.ids = append(r.changed.ids, id)
+
+	return r.Repository.DeleteUser(ctx, id)
+}
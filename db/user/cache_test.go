@@ -0,0 +1,292 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// loadingRepository считает запросы пользователя. С gate каждый запрос сообщает о начале в started
+// и ждет release, а отмененный к этому моменту ctx возвращает как ошибку
+type loadingRepository struct {
+	*MemoryRepository
+
+	mutex   *sync.Mutex
+	loads   int
+	gate    bool
+	started chan struct{}
+	release chan struct{}
+}
+
+func newLoadingRepository(gate bool) *loadingRepository {
+	return &loadingRepository{
+		MemoryRepository: NewMemoryRepository(),
+		mutex:            &sync.Mutex{},
+		gate:             gate,
+		started:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+}
+
+func (r *loadingRepository) GetUserById(ctx context.Context, id uuid.UUID) (DbUser, error) {
+	r.mutex.Lock()
+	r.loads++
+	r.mutex.Unlock()
+
+	if r.gate {
+		r.started <- struct{}{}
+		<-r.release
+
+		if err := ctx.Err(); err != nil {
+			return DbUser{}, err
+		}
+	}
+
+	return r.MemoryRepository.GetUserById(ctx, id)
+}
+
+func (r *loadingRepository) loadCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.loads
+}
+
+func addCachedUser(t *testing.T, repository Repository) uuid.UUID {
+	t.Helper()
+
+	id, err := repository.AddUser(context.Background(), DbUser{Email: uuid.NewString() + "@example.com"})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+
+	return id
+}
+
+func getCachedUser(t *testing.T, repository *CachedRepository, id uuid.UUID) {
+	t.Helper()
+
+	user, err := repository.GetUserById(context.Background(), id)
+	if err != nil {
+		t.Fatalf("could not get user: %v", err)
+	}
+	if user.Id != id {
+		t.Fatalf("got user %s, want %s", user.Id, id)
+	}
+}
+
+func TestCachedRepositoryCoalescesLoads(t *testing.T) {
+	repository := newLoadingRepository(true)
+	id := addCachedUser(t, repository)
+	cached := NewCachedRepository(repository, 10, time.Minute, 0)
+
+	const callers = 5
+	errs := make(chan error, callers)
+	for range callers {
+		go func() {
+			_, err := cached.GetUserById(context.Background(), id)
+			errs <- err
+		}()
+	}
+
+	<-repository.started
+	// остальные вызовы успевают присоединиться к начатому запросу
+	time.Sleep(20 * time.Millisecond)
+	close(repository.release)
+
+	for range callers {
+		if err := <-errs; err != nil {
+			t.Fatalf("could not get user: %v", err)
+		}
+	}
+
+	if loads := repository.loadCount(); loads != 1 {
+		t.Fatalf("got %d loads, want 1", loads)
+	}
+}
+
+func TestCachedRepositoryTTL(t *testing.T) {
+	repository := newLoadingRepository(false)
+	id := addCachedUser(t, repository)
+	cached := NewCachedRepository(repository, 10, 30*time.Millisecond, 0)
+
+	getCachedUser(t, cached, id)
+	getCachedUser(t, cached, id)
+	if loads := repository.loadCount(); loads != 1 {
+		t.Fatalf("got %d loads before expiration, want 1", loads)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	getCachedUser(t, cached, id)
+	if loads := repository.loadCount(); loads != 2 {
+		t.Fatalf("got %d loads after expiration, want 2", loads)
+	}
+}
+
+func TestCachedRepositoryNegativeCaching(t *testing.T) {
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		loads       int
+	}{
+		{name: "enabled", negativeTTL: time.Minute, loads: 1},
+		{name: "disabled", loads: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repository := newLoadingRepository(false)
+			cached := NewCachedRepository(repository, 10, time.Minute, test.negativeTTL)
+
+			id := uuid.New()
+			for range 2 {
+				if _, err := cached.GetUserById(context.Background(), id); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("got error %v, want %v", err, ErrNotFound)
+				}
+			}
+
+			if loads := repository.loadCount(); loads != test.loads {
+				t.Fatalf("got %d loads, want %d", loads, test.loads)
+			}
+		})
+	}
+}
+
+func TestCachedRepositoryInvalidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(cached *CachedRepository, id uuid.UUID)
+	}{
+		{name: "invalidate", invalidate: (*CachedRepository).Invalidate},
+		{name: "notification", invalidate: func(cached *CachedRepository, id uuid.UUID) {
+			cached.HandleNotification(id.String())
+		}},
+		{name: "unknown notification", invalidate: func(cached *CachedRepository, _ uuid.UUID) {
+			cached.HandleNotification("reconnected")
+		}},
+		{name: "update", invalidate: func(cached *CachedRepository, id uuid.UUID) {
+			user, _ := cached.Repository.GetUserById(context.Background(), id)
+			user.Name = "updated"
+			_ = cached.UpdateUser(context.Background(), user)
+		}},
+		{name: "update in transaction", invalidate: func(cached *CachedRepository, id uuid.UUID) {
+			_ = cached.WithTx(context.Background(), func(ctx context.Context, repository Repository) error {
+				user, err := repository.GetUserById(ctx, id)
+				if err != nil {
+					return err
+				}
+
+				user.Name = "updated"
+				return repository.UpdateUser(ctx, user)
+			})
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repository := newLoadingRepository(false)
+			id := addCachedUser(t, repository)
+			cached := NewCachedRepository(repository, 10, time.Minute, 0)
+
+			getCachedUser(t, cached, id)
+			test.invalidate(cached, id)
+			loads := repository.loadCount()
+
+			getCachedUser(t, cached, id)
+			if got := repository.loadCount(); got != loads+1 {
+				t.Fatalf("user was not reloaded after invalidation")
+			}
+		})
+	}
+}
+
+// TestCachedRepositoryInvalidationDuringLoad проверяет, что результат запроса не попадает в кеш, только если
+// во время запроса сбросили этого пользователя или весь кеш
+func TestCachedRepositoryInvalidationDuringLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(cached *CachedRepository, id uuid.UUID)
+		cached     bool
+	}{
+		{name: "same user", invalidate: (*CachedRepository).Invalidate},
+		{name: "other user", invalidate: func(cached *CachedRepository, _ uuid.UUID) {
+			cached.Invalidate(uuid.New())
+		}, cached: true},
+		{name: "all users", invalidate: func(cached *CachedRepository, _ uuid.UUID) {
+			cached.InvalidateAll()
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repository := newLoadingRepository(true)
+			id := addCachedUser(t, repository)
+			cached := NewCachedRepository(repository, 10, time.Minute, 0)
+
+			errs := make(chan error, 1)
+			go func() {
+				_, err := cached.GetUserById(context.Background(), id)
+				errs <- err
+			}()
+
+			<-repository.started
+			test.invalidate(cached, id)
+			close(repository.release)
+
+			if err := <-errs; err != nil {
+				t.Fatalf("could not get user: %v", err)
+			}
+
+			if _, ok := cached.cache.Get(id); ok != test.cached {
+				t.Fatalf("got cached %t, want %t", ok, test.cached)
+			}
+		})
+	}
+}
+
+// TestCachedRepositoryCancelledLeader проверяет, что отмена вызова, начавшего запрос, не ломает его остальным
+func TestCachedRepositoryCancelledLeader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	repository := newLoadingRepository(true)
+	id := addCachedUser(t, repository)
+	cached := NewCachedRepository(repository, 10, time.Minute, time.Minute)
+
+	leaderCtx, cancelLeader := context.WithCancel(ctx)
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cached.GetUserById(leaderCtx, id)
+		leaderErr <- err
+	}()
+
+	<-repository.started
+
+	waiter := make(chan error, 1)
+	go func() {
+		user, err := cached.GetUserById(ctx, id)
+		if err == nil && user.Id != id {
+			err = errors.New("got another user")
+		}
+		waiter <- err
+	}()
+
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got leader error %v, want %v", err, context.Canceled)
+	}
+
+	close(repository.release)
+	if err := <-waiter; err != nil {
+		t.Fatalf("waiter failed: %v", err)
+	}
+
+	if _, ok := cached.cache.Get(id); !ok {
+		t.Fatalf("user was not cached")
+	}
+}
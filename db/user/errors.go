@@ -0,0 +1,23 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound строки, которую читает или меняет запрос, нет. Ошибки чтения при этом остаются и sql.ErrNoRows
+	ErrNotFound = errors.New("not found")
+	// ErrConflict запрос не применен из-за уже существующих данных
+	ErrConflict = errors.New("conflict")
+)
+
+// notFound помечает sql.ErrNoRows как ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	return err
+}
@@ -5,6 +5,10 @@ import (
 	"database/sql"
 	_ "embed"
 	"errors"
+	"fmt"
+	"time"
+	"user-service/db"
+	"user-service/pkg"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -20,14 +24,49 @@ func NewRepository(db *sqlx.DB) Impl {
 	}
 }
 
+// WithTx выполняет fn в транзакции. Методы репозитория, вызванные с ctx из fn, в том числе другими репозиториями
+// через db.Conn, работают в этой транзакции. При ошибке сериализации или взаимной блокировке fn повторяется
+func (r Impl) WithTx(ctx context.Context, fn func(ctx context.Context, repository Repository) error, options ...db.TxOption) error {
+	return db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		return fn(ctx, r)
+	}, options...)
+}
+
+func (r Impl) conn(ctx context.Context) db.Querier {
+	return db.Conn(ctx, r.db)
+}
+
 //go:embed sql/get_user_by_id.sql
 var getUserByIdSql string
 
 func (r Impl) GetUserById(ctx context.Context, id uuid.UUID) (DbUser, error) {
 	var user DbUser
-	err := r.db.GetContext(ctx, &user, getUserByIdSql, id)
+	err := r.conn(ctx).GetContext(ctx, &user, getUserByIdSql, id)
+
+	return user, notFound(err)
+}
+
+//go:embed sql/get_user_by_email.sql
+var getUserByEmailSql string
+
+func (r Impl) GetUserByEmail(ctx context.Context, email string) (DbUser, error) {
+	var user DbUser
+	err := r.conn(ctx).GetContext(ctx, &user, getUserByEmailSql, email)
+
+	return user, notFound(err)
+}
+
+//go:embed sql/lock_users_by_ids.sql
+var lockUsersByIdsSql string
+
+// LockUsersByIds блокирует строки пользователей в порядке Id, чтобы параллельные пачки не взаимоблокировались.
+// Вне транзакции блокировка снимается сразу после запроса
+func (r Impl) LockUsersByIds(ctx context.Context, ids []uuid.UUID) ([]DbUser, error) {
+	users := make([]DbUser, 0, len(ids))
+
+	err := r.conn(ctx).SelectContext(ctx, &users, lockUsersByIdsSql, ids)
 
-	return user, err
+	return users, err
 }
 
 //go:embed sql/get_users.sql
@@ -36,7 +75,7 @@ var getUsersSql string
 func (r Impl) GetUsers(ctx context.Context) ([]DbUser, error) {
 	users := make([]DbUser, 0)
 
-	err := r.db.SelectContext(ctx, &users, getUsersSql)
+	err := r.conn(ctx).SelectContext(ctx, &users, getUsersSql)
 	if errors.Is(err, sql.ErrNoRows) {
 		return users, nil
 	}
@@ -47,44 +86,126 @@ func (r Impl) GetUsers(ctx context.Context) ([]DbUser, error) {
 //go:embed sql/add_user.sql
 var addUserSql string
 
-func (r Impl) AddUser(ctx context.Context, user DbUser) (id uuid.UUID, err error) {
-	rows, err := r.db.NamedQueryContext(ctx, addUserSql, user)
-	if err != nil {
-		return uuid.Nil, err
-	}
+//go:embed sql/lock_user_id.sql
+var lockUserIdSql string
 
-	defer func(rows *sqlx.Rows) {
-		if tempErr := rows.Close(); tempErr != nil {
-			err = tempErr
-		}
-	}(rows)
+// AddUser создает пользователя и в той же транзакции пишет UserCreated в outbox. Если Id не задан, его генерирует база.
+// Id пользователя блокируется до конца транзакции, поэтому ожидающие билеты, забранные TakePendingUserTickets
+// в той же транзакции, не разминутся с параллельным AddPendingUserTicket
+func (r Impl) AddUser(ctx context.Context, user DbUser) (uuid.UUID, error) {
+	var created DbUser
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
 
-	if rows.Next() {
-		err = rows.Scan(&id)
+		found, err := getNamed(ctx, tx, &created, addUserSql, user)
 		if err != nil {
-			return uuid.Nil, err
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%w: user was not inserted", ErrConflict)
+		}
+
+		if _, err = tx.ExecContext(ctx, lockUserIdSql, created.Id); err != nil {
+			return err
+		}
+
+		if err = addOutboxEvent(ctx, tx, pkg.UserCreatedType, created.Id.String(), userEvent(created)); err != nil {
+			return err
 		}
+
+		return notifyUserChanged(ctx, tx, created.Id)
+	})
+	if err != nil {
+		return uuid.Nil, err
 	}
 
-	return
+	return created.Id, nil
 }
 
 //go:embed sql/update_user.sql
 var updateUserSql string
 
+// UpdateUser обновляет email и имя пользователя и в той же транзакции пишет UserUpdated в outbox.
+// Статус, подтверждение и дата рождения не меняются. Возвращает ErrNotFound, если пользователя нет
 func (r Impl) UpdateUser(ctx context.Context, user DbUser) error {
-	_, err := r.db.NamedExecContext(ctx, updateUserSql, user)
+	return r.updateUser(ctx, updateUserSql, user)
+}
 
-	return err
+//go:embed sql/update_user_verification.sql
+var updateUserVerificationSql string
+
+// UpdateUserVerification обновляет статус, подтверждение и дату рождения пользователя и в той же транзакции
+// пишет UserUpdated в outbox. Возвращает ErrNotFound, если пользователя нет
+func (r Impl) UpdateUserVerification(ctx context.Context, verification DbUserVerification) error {
+	return r.updateUser(ctx, updateUserVerificationSql, verification)
+}
+
+func (r Impl) updateUser(ctx context.Context, query string, arg any) error {
+	return db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
+
+		var updated DbUser
+		found, err := getNamed(ctx, tx, &updated, query, arg)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrNotFound
+		}
+
+		if err = addOutboxEvent(ctx, tx, pkg.UserUpdatedType, updated.Id.String(), userEvent(updated)); err != nil {
+			return err
+		}
+
+		return notifyUserChanged(ctx, tx, updated.Id)
+	})
 }
 
 //go:embed sql/delete_user.sql
 var deleteUserSql string
 
+// DeleteUser удаляет пользователя и в той же транзакции пишет UserDeleted в outbox. Возвращает ErrNotFound, если пользователя нет
 func (r Impl) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.ExecContext(ctx, deleteUserSql, id)
+	return db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
 
-	return err
+		result, err := tx.ExecContext(ctx, deleteUserSql, id)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrNotFound
+		}
+
+		if err = addOutboxEvent(ctx, tx, pkg.UserDeletedType, id.String(), pkg.UserDeleted{Id: id}); err != nil {
+			return err
+		}
+
+		return notifyUserChanged(ctx, tx, id)
+	})
+}
+
+// getNamed выполняет именованный запрос и сканирует первую строку в dest. Возвращает false, если строк нет
+func getNamed(ctx context.Context, tx db.Querier, dest any, query string, arg any) (bool, error) {
+	rows, err := sqlx.NamedQueryContext(ctx, tx, query, arg)
+	if err != nil {
+		return false, err
+	}
+
+	found := rows.Next()
+	if found {
+		if err = rows.StructScan(dest); err != nil {
+			_ = rows.Close()
+			return false, err
+		}
+	}
+
+	return found, rows.Close()
 }
 
 //go:embed sql/get_user_tickets_by_user_id.sql
@@ -93,7 +214,7 @@ var getUserTicketsByUserIdSql string
 func (r Impl) GetUserTicketsByUserId(ctx context.Context, userId uuid.UUID) ([]DbUserTicket, error) {
 	userTickets := make([]DbUserTicket, 0)
 
-	err := r.db.SelectContext(ctx, &userTickets, getUserTicketsByUserIdSql, userId)
+	err := r.conn(ctx).SelectContext(ctx, &userTickets, getUserTicketsByUserIdSql, userId)
 	if errors.Is(err, sql.ErrNoRows) {
 		return userTickets, nil
 	}
@@ -101,11 +222,425 @@ func (r Impl) GetUserTicketsByUserId(ctx context.Context, userId uuid.UUID) ([]D
 	return userTickets, err
 }
 
+//go:embed sql/count_user_tickets_by_event.sql
+var countUserTicketsByEventSql string
+
+// CountUserTicketsByEvent считает билеты пользователя на событие, кроме exceptTicketId
+func (r Impl) CountUserTicketsByEvent(ctx context.Context, userId uuid.UUID, eventId, exceptTicketId string) (int, error) {
+	var count int
+	err := r.conn(ctx).GetContext(ctx, &count, countUserTicketsByEventSql, userId, eventId, exceptTicketId)
+
+	return count, err
+}
+
 //go:embed sql/add_user_ticket.sql
 var addUserTicketSql string
 
 func (r Impl) AddUserTicket(ctx context.Context, userTicket DbUserTicket) error {
-	_, err := r.db.NamedExecContext(ctx, addUserTicketSql, userTicket)
+	_, err := r.conn(ctx).NamedExecContext(ctx, addUserTicketSql, userTicket)
 
 	return err
 }
+
+//go:embed sql/transfer_user_ticket.sql
+var transferUserTicketSql string
+
+//go:embed sql/add_ticket_transfer.sql
+var addTicketTransferSql string
+
+// TransferUserTicket передает билет от FromUserId к ToUserId, записывает передачу в историю и TicketTransferred в outbox
+// в одной транзакции. Возвращает ErrNotFound, если у FromUserId нет такого билета
+func (r Impl) TransferUserTicket(ctx context.Context, transfer DbTicketTransfer) (DbTicketTransfer, error) {
+	var result DbTicketTransfer
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
+
+		updated, err := tx.NamedExecContext(ctx, transferUserTicketSql, transfer)
+		if err != nil {
+			return err
+		}
+
+		affected, err := updated.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return notFound(sql.ErrNoRows)
+		}
+
+		if _, err = getNamed(ctx, tx, &result, addTicketTransferSql, transfer); err != nil {
+			return err
+		}
+
+		return addOutboxEvent(ctx, tx, pkg.TicketTransferredType, result.TicketId, ticketTransferredEvent(result))
+	})
+	if err != nil {
+		return DbTicketTransfer{}, err
+	}
+
+	return result, nil
+}
+
+//go:embed sql/add_processed_message.sql
+var addProcessedMessageSql string
+
+// AddProcessedMessage записывает сообщение в журнал без изменения билетов, например для отклоненного бронирования.
+// Возвращает false, если сообщение уже было обработано
+func (r Impl) AddProcessedMessage(ctx context.Context, message DbProcessedMessage) (bool, error) {
+	return addProcessedMessage(ctx, r.conn(ctx), message)
+}
+
+//go:embed sql/get_processed_message_ids.sql
+var getProcessedMessageIdsSql string
+
+// GetProcessedMessageIds возвращает те из messageIds, которые уже есть в журнале обработанных сообщений consumer
+func (r Impl) GetProcessedMessageIds(ctx context.Context, consumer string, messageIds []string) ([]string, error) {
+	processed := make([]string, 0)
+
+	err := r.conn(ctx).SelectContext(ctx, &processed, getProcessedMessageIdsSql, consumer, messageIds)
+
+	return processed, err
+}
+
+func addProcessedMessage(ctx context.Context, tx db.Querier, message DbProcessedMessage) (bool, error) {
+	result, err := tx.NamedExecContext(ctx, addProcessedMessageSql, message)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// AddUserTicketFromMessage добавляет билет и запись о сообщении в одной транзакции.
+// Возвращает false, если сообщение уже было обработано, и конфликт, если у билета уже есть другой владелец
+func (r Impl) AddUserTicketFromMessage(ctx context.Context, message DbProcessedMessage, userTicket DbUserTicket) (bool, []DbTicketConflict, error) {
+	var (
+		processed bool
+		conflicts []DbTicketConflict
+	)
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) (err error) {
+		tx := r.conn(ctx)
+
+		if processed, err = addProcessedMessage(ctx, tx, message); err != nil || !processed {
+			return err
+		}
+
+		_, conflicts, err = addUserTickets(ctx, tx, []DbUserTicket{userTicket}, []string{message.MessageId})
+
+		return err
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	return processed, conflicts, nil
+}
+
+//go:embed sql/add_processed_messages.sql
+var addProcessedMessagesSql string
+
+// AddUserTickets добавляет билеты пачки сообщений в одной транзакции, messages[i] соответствует userTickets[i].
+// Билеты из уже обработанных сообщений пропускаются. Возвращает количество добавленных билетов и конфликты владения
+func (r Impl) AddUserTickets(ctx context.Context, messages []DbProcessedMessage, userTickets []DbUserTicket) (int64, []DbTicketConflict, error) {
+	if len(messages) != len(userTickets) {
+		return 0, nil, fmt.Errorf("got %d messages for %d tickets", len(messages), len(userTickets))
+	}
+	if len(messages) == 0 {
+		return 0, nil, nil
+	}
+
+	var (
+		added     int64
+		conflicts []DbTicketConflict
+	)
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
+
+		rows, err := sqlx.NamedQueryContext(ctx, tx, addProcessedMessagesSql, messages)
+		if err != nil {
+			return err
+		}
+
+		fresh := make(map[DbProcessedMessage]struct{}, len(messages))
+		for rows.Next() {
+			var message DbProcessedMessage
+			if err = rows.StructScan(&message); err != nil {
+				_ = rows.Close()
+				return err
+			}
+
+			fresh[message] = struct{}{}
+		}
+		if err = rows.Close(); err != nil {
+			return err
+		}
+
+		tickets := make([]DbUserTicket, 0, len(fresh))
+		messageIds := make([]string, 0, len(fresh))
+		for i, message := range messages {
+			if _, ok := fresh[message]; ok {
+				tickets = append(tickets, userTickets[i])
+				messageIds = append(messageIds, message.MessageId)
+			}
+		}
+
+		added, conflicts, err = addUserTickets(ctx, tx, tickets, messageIds)
+
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return added, conflicts, nil
+}
+
+//go:embed sql/add_user_tickets.sql
+var addUserTicketsSql string
+
+//go:embed sql/get_ticket_owners.sql
+var getTicketOwnersSql string
+
+//go:embed sql/add_ticket_conflicts.sql
+var addTicketConflictsSql string
+
+// addUserTickets вставляет билеты, messageIds[i] - сообщение билета tickets[i]. Билет, который уже принадлежит
+// другому пользователю, не вставляется, а попадает в карантин ticket_ownership_conflicts, и в outbox пишется
+// TicketOwnershipConflict. Повторная привязка билета к тому же пользователю не считается конфликтом
+func addUserTickets(ctx context.Context, tx db.Querier, tickets []DbUserTicket, messageIds []string) (int64, []DbTicketConflict, error) {
+	if len(tickets) == 0 {
+		return 0, nil, nil
+	}
+
+	rows, err := sqlx.NamedQueryContext(ctx, tx, addUserTicketsSql, tickets)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	inserted := make(map[DbUserTicket]struct{}, len(tickets))
+	for rows.Next() {
+		var ticket DbUserTicket
+		if err = rows.StructScan(&ticket); err != nil {
+			_ = rows.Close()
+			return 0, nil, err
+		}
+
+		inserted[ticket] = struct{}{}
+	}
+	if err = rows.Close(); err != nil {
+		return 0, nil, err
+	}
+
+	if len(inserted) == len(tickets) {
+		return int64(len(inserted)), nil, nil
+	}
+
+	ticketIds := make([]string, 0, len(tickets))
+	for _, ticket := range tickets {
+		ticketIds = append(ticketIds, ticket.TicketId)
+	}
+
+	var owners []DbUserTicket
+	if err = tx.SelectContext(ctx, &owners, getTicketOwnersSql, ticketIds); err != nil {
+		return 0, nil, err
+	}
+
+	ownerIds := make(map[string]uuid.UUID, len(owners))
+	for _, owner := range owners {
+		ownerIds[owner.TicketId] = owner.UserId
+	}
+
+	var conflicts []DbTicketConflict
+	for i, ticket := range tickets {
+		if _, ok := inserted[ticket]; ok {
+			continue
+		}
+
+		if owner, ok := ownerIds[ticket.TicketId]; ok && owner != ticket.UserId {
+			conflicts = append(conflicts, DbTicketConflict{
+				TicketId:    ticket.TicketId,
+				UserId:      ticket.UserId,
+				OwnerUserId: owner,
+				MessageId:   messageIds[i],
+				Source:      TicketConflictBooking,
+			})
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return int64(len(inserted)), nil, nil
+	}
+
+	rows, err = sqlx.NamedQueryContext(ctx, tx, addTicketConflictsSql, conflicts)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	conflicts = conflicts[:0]
+	for rows.Next() {
+		var conflict DbTicketConflict
+		if err = rows.StructScan(&conflict); err != nil {
+			_ = rows.Close()
+			return 0, nil, err
+		}
+
+		conflicts = append(conflicts, conflict)
+	}
+	if err = rows.Close(); err != nil {
+		return 0, nil, err
+	}
+
+	for _, conflict := range conflicts {
+		if err = addOutboxEvent(ctx, tx, pkg.TicketOwnershipConflictType, conflict.TicketId, ticketConflictEvent(conflict)); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return int64(len(inserted)), conflicts, nil
+}
+
+func (r Impl) GetTicketOwners(ctx context.Context, ticketIds []string) ([]DbUserTicket, error) {
+	owners := make([]DbUserTicket, 0, len(ticketIds))
+
+	err := r.conn(ctx).SelectContext(ctx, &owners, getTicketOwnersSql, ticketIds)
+
+	return owners, err
+}
+
+//go:embed sql/get_ticket_conflicts.sql
+var getTicketConflictsSql string
+
+// GetTicketConflicts возвращает конфликты владения билетами из источника source, а при пустом source - все
+func (r Impl) GetTicketConflicts(ctx context.Context, source string) ([]DbTicketConflict, error) {
+	conflicts := make([]DbTicketConflict, 0)
+
+	err := r.conn(ctx).SelectContext(ctx, &conflicts, getTicketConflictsSql, source)
+
+	return conflicts, err
+}
+
+//go:embed sql/user_exists.sql
+var userExistsSql string
+
+//go:embed sql/add_pending_user_ticket.sql
+var addPendingUserTicketSql string
+
+// AddPendingUserTicket откладывает билет пользователя, которого еще нет в базе, и записывает сообщение в журнал.
+// Блокировка по id пользователя не дает билету разминуться с параллельным AddUser: если пользователь успел появиться,
+// возвращается ErrConflict, и бронирование нужно обработать заново с проверкой политики. Возвращает true, если билет
+// отложен, и false, если сообщение уже есть в журнале
+func (r Impl) AddPendingUserTicket(ctx context.Context, message DbProcessedMessage, ticket DbPendingUserTicket) (bool, error) {
+	var pending bool
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
+
+		if _, err := tx.ExecContext(ctx, lockUserIdSql, ticket.UserId); err != nil {
+			return err
+		}
+
+		var exists bool
+		if err := tx.GetContext(ctx, &exists, userExistsSql, ticket.UserId); err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: user %s already exists", ErrConflict, ticket.UserId)
+		}
+
+		processed, err := addProcessedMessage(ctx, tx, message)
+		if err != nil || !processed {
+			return err
+		}
+
+		pending = true
+		ticket.MessageId = message.MessageId
+		_, err = tx.NamedExecContext(ctx, addPendingUserTicketSql, ticket)
+
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return pending, nil
+}
+
+//go:embed sql/take_pending_user_tickets.sql
+var takePendingUserTicketsSql string
+
+// TakePendingUserTickets удаляет и возвращает билеты, ожидавшие пользователя userId.
+// Вызывается в транзакции AddUser, иначе билеты пропадут при ее откате
+func (r Impl) TakePendingUserTickets(ctx context.Context, userId uuid.UUID) ([]DbPendingUserTicket, error) {
+	tickets := make([]DbPendingUserTicket, 0)
+
+	err := r.conn(ctx).SelectContext(ctx, &tickets, takePendingUserTicketsSql, userId)
+
+	return tickets, err
+}
+
+// AttachUserTickets добавляет забранные из ожидания билеты. Сообщения билетов уже есть в журнале, поэтому он не меняется.
+// Возвращает количество добавленных билетов и конфликты владения
+func (r Impl) AttachUserTickets(ctx context.Context, tickets []DbPendingUserTicket) (int64, []DbTicketConflict, error) {
+	if len(tickets) == 0 {
+		return 0, nil, nil
+	}
+
+	var (
+		added     int64
+		conflicts []DbTicketConflict
+	)
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) (err error) {
+		userTickets, messageIds := pendingTickets(tickets)
+		added, conflicts, err = addUserTickets(ctx, r.conn(ctx), userTickets, messageIds)
+
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return added, conflicts, nil
+}
+
+func pendingTickets(tickets []DbPendingUserTicket) ([]DbUserTicket, []string) {
+	userTickets := make([]DbUserTicket, 0, len(tickets))
+	messageIds := make([]string, 0, len(tickets))
+	for _, ticket := range tickets {
+		userTickets = append(userTickets, DbUserTicket{
+			UserId:   ticket.UserId,
+			TicketId: ticket.TicketId,
+			EventId:  ticket.EventId,
+		})
+		messageIds = append(messageIds, ticket.MessageId)
+	}
+
+	return userTickets, messageIds
+}
+
+//go:embed sql/delete_pending_user_tickets.sql
+var deletePendingUserTicketsSql string
+
+// DeletePendingUserTickets удаляет билеты, отложенные раньше before, и возвращает их
+func (r Impl) DeletePendingUserTickets(ctx context.Context, before time.Time) ([]DbPendingUserTicket, error) {
+	tickets := make([]DbPendingUserTicket, 0)
+
+	err := r.conn(ctx).SelectContext(ctx, &tickets, deletePendingUserTicketsSql, before)
+
+	return tickets, err
+}
+
+//go:embed sql/delete_processed_messages.sql
+var deleteProcessedMessagesSql string
+
+func (r Impl) DeleteProcessedMessages(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, deleteProcessedMessagesSql, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,607 @@
+package user
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"user-service/db"
+	"user-service/pkg"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	foreignKeyViolationCode = "23503"
+	uniqueViolationCode     = "23505"
+	checkViolationCode      = "23514"
+)
+
+type memoryTxKey struct{}
+
+type pendingKey struct {
+	userId   uuid.UUID
+	ticketId string
+}
+
+// MemoryRepository репозиторий в памяти для тестов сервиса и правил приема бронирований.
+// Повторяет ограничения схемы postgres и возвращает такие же коды ошибок, каждый метод атомарен
+type MemoryRepository struct {
+	mutex     *sync.Mutex
+	users     map[uuid.UUID]DbUser
+	tickets   map[string]DbUserTicket
+	pending   map[pendingKey]DbPendingUserTicket
+	processed map[DbProcessedMessage]time.Time
+	transfers []DbTicketTransfer
+	conflicts []DbTicketConflict
+	backfills map[string]uuid.UUID
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		mutex:     &sync.Mutex{},
+		users:     make(map[uuid.UUID]DbUser),
+		tickets:   make(map[string]DbUserTicket),
+		pending:   make(map[pendingKey]DbPendingUserTicket),
+		processed: make(map[DbProcessedMessage]time.Time),
+		backfills: make(map[string]uuid.UUID),
+	}
+}
+
+// WithTx при ошибке fn возвращает репозиторий в состояние до вызова. Изоляции нет: изменения,
+// сделанные параллельно с fn, при откате тоже теряются. Вложенный вызов присоединяется к внешнему
+func (r *MemoryRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repository Repository) error, _ ...db.TxOption) error {
+	if _, ok := ctx.Value(memoryTxKey{}).(bool); ok {
+		return fn(ctx, r)
+	}
+
+	snapshot := r.snapshot()
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, true), r); err != nil {
+		r.restore(snapshot)
+		return err
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) snapshot() MemoryRepository {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return MemoryRepository{
+		users:     maps.Clone(r.users),
+		tickets:   maps.Clone(r.tickets),
+		pending:   maps.Clone(r.pending),
+		processed: maps.Clone(r.processed),
+		transfers: slices.Clone(r.transfers),
+		conflicts: slices.Clone(r.conflicts),
+		backfills: maps.Clone(r.backfills),
+	}
+}
+
+func (r *MemoryRepository) restore(snapshot MemoryRepository) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.users = snapshot.users
+	r.tickets = snapshot.tickets
+	r.pending = snapshot.pending
+	r.processed = snapshot.processed
+	r.transfers = snapshot.transfers
+	r.conflicts = snapshot.conflicts
+	r.backfills = snapshot.backfills
+}
+
+func (r *MemoryRepository) GetUserById(_ context.Context, id uuid.UUID) (DbUser, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return DbUser{}, notFound(sql.ErrNoRows)
+	}
+
+	return user, nil
+}
+
+func (r *MemoryRepository) GetUserByEmail(_ context.Context, email string) (DbUser, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return DbUser{}, notFound(sql.ErrNoRows)
+}
+
+func (r *MemoryRepository) GetUsers(_ context.Context) ([]DbUser, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	users := make([]DbUser, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+
+	slices.SortFunc(users, func(a, b DbUser) int {
+		return strings.Compare(a.Id.String(), b.Id.String())
+	})
+
+	return users, nil
+}
+
+func (r *MemoryRepository) LockUsersByIds(_ context.Context, ids []uuid.UUID) ([]DbUser, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	users := make([]DbUser, 0, len(ids))
+	for id, user := range r.users {
+		if slices.Contains(ids, id) {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+func (r *MemoryRepository) AddUser(_ context.Context, user DbUser) (uuid.UUID, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if user.Id == uuid.Nil {
+		user.Id = uuid.New()
+	}
+	if len(user.Status) == 0 {
+		user.Status = pkg.UserStatusActive
+	}
+
+	if _, ok := r.users[user.Id]; ok {
+		return uuid.Nil, violation(uniqueViolationCode, "users_pkey")
+	}
+	if err := r.checkUserLocked(user); err != nil {
+		return uuid.Nil, err
+	}
+
+	r.users[user.Id] = user
+
+	return user.Id, nil
+}
+
+func (r *MemoryRepository) UpdateUser(_ context.Context, user DbUser) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	current, ok := r.users[user.Id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	user.Status, user.Verified, user.BirthDate = current.Status, current.Verified, current.BirthDate
+	if err := r.checkUserLocked(user); err != nil {
+		return err
+	}
+
+	r.users[user.Id] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateUserVerification(_ context.Context, verification DbUserVerification) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	user, ok := r.users[verification.Id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if len(verification.Status) > 0 {
+		user.Status = verification.Status
+	}
+	user.Verified, user.BirthDate = verification.Verified, verification.BirthDate
+	if err := r.checkUserLocked(user); err != nil {
+		return err
+	}
+
+	r.users[user.Id] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteUser(_ context.Context, id uuid.UUID) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(r.users, id)
+	for ticketId, ticket := range r.tickets {
+		if ticket.UserId == id {
+			delete(r.tickets, ticketId)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) GetUserTicketsByUserId(_ context.Context, userId uuid.UUID) ([]DbUserTicket, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tickets := make([]DbUserTicket, 0)
+	for _, ticket := range r.tickets {
+		if ticket.UserId == userId {
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	slices.SortFunc(tickets, func(a, b DbUserTicket) int {
+		return strings.Compare(a.TicketId, b.TicketId)
+	})
+
+	return tickets, nil
+}
+
+func (r *MemoryRepository) CountUserTicketsByEvent(_ context.Context, userId uuid.UUID, eventId, exceptTicketId string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := 0
+	for _, ticket := range r.tickets {
+		if ticket.UserId == userId && ticket.EventId == eventId && ticket.TicketId != exceptTicketId {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *MemoryRepository) AddUserTicket(_ context.Context, userTicket DbUserTicket) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.checkUsersLocked([]DbUserTicket{userTicket}); err != nil {
+		return err
+	}
+	if _, ok := r.tickets[userTicket.TicketId]; ok {
+		return violation(uniqueViolationCode, "user_tickets_ticket_id_uidx")
+	}
+
+	r.tickets[userTicket.TicketId] = userTicket
+
+	return nil
+}
+
+func (r *MemoryRepository) GetTicketOwners(_ context.Context, ticketIds []string) ([]DbUserTicket, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	owners := make([]DbUserTicket, 0, len(ticketIds))
+	for _, ticketId := range ticketIds {
+		if ticket, ok := r.tickets[ticketId]; ok {
+			owners = append(owners, ticket)
+		}
+	}
+
+	return owners, nil
+}
+
+func (r *MemoryRepository) GetTicketConflicts(_ context.Context, source string) ([]DbTicketConflict, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	conflicts := make([]DbTicketConflict, 0, len(r.conflicts))
+	for _, conflict := range r.conflicts {
+		if len(source) == 0 || conflict.Source == source {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return conflicts, nil
+}
+
+func (r *MemoryRepository) TransferUserTicket(_ context.Context, transfer DbTicketTransfer) (DbTicketTransfer, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ticket, ok := r.tickets[transfer.TicketId]
+	if !ok || ticket.UserId != transfer.FromUserId {
+		return DbTicketTransfer{}, notFound(sql.ErrNoRows)
+	}
+	if _, ok = r.users[transfer.ToUserId]; !ok {
+		return DbTicketTransfer{}, violation(foreignKeyViolationCode, "user_tickets_user_id_fkey")
+	}
+
+	ticket.UserId = transfer.ToUserId
+	r.tickets[ticket.TicketId] = ticket
+
+	transfer.Id = uuid.New()
+	transfer.TransferredAt = time.Now()
+	r.transfers = append(r.transfers, transfer)
+
+	return transfer, nil
+}
+
+func (r *MemoryRepository) AddProcessedMessage(_ context.Context, message DbProcessedMessage) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.addProcessedLocked(message), nil
+}
+
+func (r *MemoryRepository) GetProcessedMessageIds(_ context.Context, consumer string, messageIds []string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	processed := make([]string, 0)
+	for _, messageId := range messageIds {
+		if _, ok := r.processed[DbProcessedMessage{Consumer: consumer, MessageId: messageId}]; ok {
+			processed = append(processed, messageId)
+		}
+	}
+
+	return processed, nil
+}
+
+// AddBookingRejected ничего не делает: outbox в памяти не ведется
+func (r *MemoryRepository) AddBookingRejected(_ context.Context, _ DbBookingRejection) error {
+	return nil
+}
+
+func (r *MemoryRepository) AddUserTicketFromMessage(_ context.Context, message DbProcessedMessage, userTicket DbUserTicket) (bool, []DbTicketConflict, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.processed[message]; ok {
+		return false, nil, nil
+	}
+	if err := r.checkUsersLocked([]DbUserTicket{userTicket}); err != nil {
+		return false, nil, err
+	}
+
+	r.addProcessedLocked(message)
+	_, conflicts := r.addTicketsLocked([]DbUserTicket{userTicket}, []string{message.MessageId})
+
+	return true, conflicts, nil
+}
+
+func (r *MemoryRepository) AddUserTickets(_ context.Context, messages []DbProcessedMessage, userTickets []DbUserTicket) (int64, []DbTicketConflict, error) {
+	if len(messages) != len(userTickets) {
+		return 0, nil, fmt.Errorf("got %d messages for %d tickets", len(messages), len(userTickets))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tickets := make([]DbUserTicket, 0, len(userTickets))
+	messageIds := make([]string, 0, len(messages))
+	seen := make(map[DbProcessedMessage]struct{}, len(messages))
+	for i, message := range messages {
+		if _, ok := r.processed[message]; ok {
+			continue
+		}
+		if _, ok := seen[message]; ok {
+			continue
+		}
+
+		seen[message] = struct{}{}
+		tickets = append(tickets, userTickets[i])
+		messageIds = append(messageIds, message.MessageId)
+	}
+
+	if err := r.checkUsersLocked(tickets); err != nil {
+		return 0, nil, err
+	}
+
+	for message := range seen {
+		r.addProcessedLocked(message)
+	}
+
+	added, conflicts := r.addTicketsLocked(tickets, messageIds)
+
+	return added, conflicts, nil
+}
+
+func (r *MemoryRepository) AddPendingUserTicket(_ context.Context, message DbProcessedMessage, ticket DbPendingUserTicket) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.users[ticket.UserId]; ok {
+		return false, fmt.Errorf("%w: user %s already exists", ErrConflict, ticket.UserId)
+	}
+
+	if !r.addProcessedLocked(message) {
+		return false, nil
+	}
+
+	key := pendingKey{userId: ticket.UserId, ticketId: ticket.TicketId}
+	if _, ok := r.pending[key]; !ok {
+		ticket.MessageId = message.MessageId
+		ticket.CreatedAt = time.Now()
+		r.pending[key] = ticket
+	}
+
+	return true, nil
+}
+
+// TakePendingUserTickets возвращает билеты в порядке их откладывания
+func (r *MemoryRepository) TakePendingUserTickets(_ context.Context, userId uuid.UUID) ([]DbPendingUserTicket, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tickets := make([]DbPendingUserTicket, 0)
+	for key, ticket := range r.pending {
+		if key.userId == userId {
+			delete(r.pending, key)
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	slices.SortFunc(tickets, func(a, b DbPendingUserTicket) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.TicketId, b.TicketId))
+	})
+
+	return tickets, nil
+}
+
+func (r *MemoryRepository) AttachUserTickets(_ context.Context, tickets []DbPendingUserTicket) (int64, []DbTicketConflict, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	userTickets, messageIds := pendingTickets(tickets)
+	if err := r.checkUsersLocked(userTickets); err != nil {
+		return 0, nil, err
+	}
+
+	added, conflicts := r.addTicketsLocked(userTickets, messageIds)
+
+	return added, conflicts, nil
+}
+
+func (r *MemoryRepository) DeletePendingUserTickets(_ context.Context, before time.Time) ([]DbPendingUserTicket, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	expired := make([]DbPendingUserTicket, 0)
+	for key, ticket := range r.pending {
+		if ticket.CreatedAt.Before(before) {
+			delete(r.pending, key)
+			expired = append(expired, ticket)
+		}
+	}
+
+	return expired, nil
+}
+
+func (r *MemoryRepository) DeleteProcessedMessages(_ context.Context, before time.Time) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var deleted int64
+	for message, processedAt := range r.processed {
+		if processedAt.Before(before) {
+			delete(r.processed, message)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// SnapshotUsers только сдвигает позицию backfill: outbox в памяти не ведется
+func (r *MemoryRepository) SnapshotUsers(_ context.Context, backfill string, limit int) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	after := r.backfills[backfill].String()
+
+	ids := make([]string, 0, len(r.users))
+	for id := range r.users {
+		if id.String() > after {
+			ids = append(ids, id.String())
+		}
+	}
+
+	slices.Sort(ids)
+	ids = ids[:min(len(ids), limit)]
+	if len(ids) > 0 {
+		r.backfills[backfill] = uuid.MustParse(ids[len(ids)-1])
+	}
+
+	return len(ids), nil
+}
+
+func (r *MemoryRepository) ResetUserSnapshots(_ context.Context, backfill string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.backfills, backfill)
+
+	return nil
+}
+
+func (r *MemoryRepository) addProcessedLocked(message DbProcessedMessage) bool {
+	if _, ok := r.processed[message]; ok {
+		return false
+	}
+
+	r.processed[message] = time.Now()
+
+	return true
+}
+
+// addTicketsLocked повторяет addUserTickets: билет другого владельца попадает в карантин
+func (r *MemoryRepository) addTicketsLocked(tickets []DbUserTicket, messageIds []string) (int64, []DbTicketConflict) {
+	var added int64
+	var conflicts []DbTicketConflict
+	for i, ticket := range tickets {
+		owner, ok := r.tickets[ticket.TicketId]
+		if !ok {
+			r.tickets[ticket.TicketId] = ticket
+			added++
+			continue
+		}
+		if owner.UserId == ticket.UserId {
+			continue
+		}
+
+		conflict := DbTicketConflict{
+			Id:          int64(len(r.conflicts) + 1),
+			TicketId:    ticket.TicketId,
+			UserId:      ticket.UserId,
+			OwnerUserId: owner.UserId,
+			MessageId:   messageIds[i],
+			Source:      TicketConflictBooking,
+			DetectedAt:  time.Now(),
+		}
+
+		r.conflicts = append(r.conflicts, conflict)
+		conflicts = append(conflicts, conflict)
+	}
+
+	return added, conflicts
+}
+
+func (r *MemoryRepository) checkUsersLocked(tickets []DbUserTicket) error {
+	for _, ticket := range tickets {
+		if _, ok := r.users[ticket.UserId]; !ok {
+			return violation(foreignKeyViolationCode, "user_tickets_user_id_fkey")
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) checkUserLocked(user DbUser) error {
+	if user.Status != pkg.UserStatusActive && user.Status != pkg.UserStatusSuspended {
+		return violation(checkViolationCode, "users_status_check")
+	}
+
+	for id, existing := range r.users {
+		if id != user.Id && existing.Email == user.Email {
+			return violation(uniqueViolationCode, "users_email_key")
+		}
+	}
+
+	return nil
+}
+
+func violation(code, constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           code,
+		Message:        fmt.Sprintf("violates constraint %q", constraint),
+		ConstraintName: constraint,
+	}
+}
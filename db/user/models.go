@@ -1,15 +1,84 @@
 package user
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type DbUser struct {
-	Id      uuid.UUID `db:"id"`
-	Email   string    `db:"email"`
-	Name    string    `db:"name"`
-	Surname string    `db:"surname"`
+	Id        uuid.UUID  `db:"id"`
+	Email     string     `db:"email"`
+	Name      string     `db:"name"`
+	Surname   string     `db:"surname"`
+	Status    string     `db:"status"`
+	Verified  bool       `db:"verified"`
+	BirthDate *time.Time `db:"birth_date"`
+}
+
+// DbUserVerification поля пользователя, которые меняет только администратор. Пустой Status не меняется
+type DbUserVerification struct {
+	Id        uuid.UUID  `db:"id"`
+	Status    string     `db:"status"`
+	Verified  bool       `db:"verified"`
+	BirthDate *time.Time `db:"birth_date"`
 }
 
 type DbUserTicket struct {
 	UserId   uuid.UUID `db:"user_id"`
 	TicketId string    `db:"ticket_id"`
+	EventId  string    `db:"event_id"`
+}
+
+type DbProcessedMessage struct {
+	Consumer  string `db:"consumer"`
+	MessageId string `db:"message_id"`
+}
+
+// DbPendingUserTicket билет пользователя, которого еще нет в базе. MinAge - возрастное ограничение бронирования,
+// по нему политика проверяется при появлении пользователя
+type DbPendingUserTicket struct {
+	UserId    uuid.UUID `db:"user_id"`
+	TicketId  string    `db:"ticket_id"`
+	EventId   string    `db:"event_id"`
+	MessageId string    `db:"message_id"`
+	MinAge    int       `db:"min_age"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// DbBookingRejection бронирование, отклоненное политикой. Reason - код нарушенного правила
+type DbBookingRejection struct {
+	UserId     uuid.UUID
+	TicketId   string
+	EventId    string
+	MessageId  string
+	Reason     string
+	RejectedAt time.Time
+}
+
+// DbTicketTransfer запись истории передачи билета другому пользователю
+type DbTicketTransfer struct {
+	Id            uuid.UUID `db:"id"`
+	TicketId      string    `db:"ticket_id"`
+	FromUserId    uuid.UUID `db:"from_user_id"`
+	ToUserId      uuid.UUID `db:"to_user_id"`
+	InitiatedBy   string    `db:"initiated_by"`
+	TransferredAt time.Time `db:"transferred_at"`
+}
+
+const (
+	TicketConflictMigration = "migration"
+	TicketConflictBooking   = "booking"
+)
+
+// DbTicketConflict билет, который пытались привязать к UserId, хотя им уже владеет OwnerUserId.
+// Source - migration для найденных при миграции дублей и booking для бронирований в карантине
+type DbTicketConflict struct {
+	Id          int64     `db:"id"`
+	TicketId    string    `db:"ticket_id"`
+	UserId      uuid.UUID `db:"user_id"`
+	OwnerUserId uuid.UUID `db:"owner_user_id"`
+	MessageId   string    `db:"message_id"`
+	Source      string    `db:"source"`
+	DetectedAt  time.Time `db:"detected_at"`
 }
@@ -0,0 +1,147 @@
+package user
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"user-service/db"
+	"user-service/pkg"
+
+	"github.com/google/uuid"
+)
+
+//go:embed sql/add_outbox_event.sql
+var addOutboxEventSql string
+
+// addOutboxEvent записывает событие в outbox в транзакции изменения. aggregateId - id пользователя или билета,
+// он же ключ сообщения. Relay публикует события одного агрегата в порядке записи
+func addOutboxEvent(ctx context.Context, tx db.Querier, eventType string, aggregateId string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", eventType, err)
+	}
+
+	_, err = tx.ExecContext(ctx, addOutboxEventSql, aggregateId, eventType, data)
+
+	return err
+}
+
+func userEvent(user DbUser) pkg.User {
+	return pkg.User{
+		Id:        user.Id,
+		Email:     user.Email,
+		Name:      user.Name,
+		Surname:   user.Surname,
+		Status:    user.Status,
+		Verified:  user.Verified,
+		BirthDate: user.BirthDate,
+	}
+}
+
+func ticketTransferredEvent(transfer DbTicketTransfer) pkg.TicketTransferred {
+	return pkg.TicketTransferred{
+		TransferId:    transfer.Id,
+		TicketId:      transfer.TicketId,
+		FromUserId:    transfer.FromUserId,
+		ToUserId:      transfer.ToUserId,
+		InitiatedBy:   transfer.InitiatedBy,
+		TransferredAt: transfer.TransferredAt,
+	}
+}
+
+func ticketConflictEvent(conflict DbTicketConflict) pkg.TicketOwnershipConflict {
+	return pkg.TicketOwnershipConflict{
+		ConflictId:  conflict.Id,
+		TicketId:    conflict.TicketId,
+		UserId:      conflict.UserId,
+		OwnerUserId: conflict.OwnerUserId,
+		MessageId:   conflict.MessageId,
+		DetectedAt:  conflict.DetectedAt,
+	}
+}
+
+func bookingRejectedEvent(rejection DbBookingRejection) pkg.BookingRejected {
+	return pkg.BookingRejected{
+		UserId:     rejection.UserId,
+		TicketId:   rejection.TicketId,
+		EventId:    rejection.EventId,
+		MessageId:  rejection.MessageId,
+		Reason:     rejection.Reason,
+		RejectedAt: rejection.RejectedAt,
+	}
+}
+
+// AddBookingRejected пишет BookingRejected в outbox. Вызывается в транзакции, которая записывает сообщение в журнал,
+// чтобы отказ по одному сообщению публиковался один раз
+func (r Impl) AddBookingRejected(ctx context.Context, rejection DbBookingRejection) error {
+	return addOutboxEvent(ctx, r.conn(ctx), pkg.BookingRejectedType, rejection.UserId.String(), bookingRejectedEvent(rejection))
+}
+
+//go:embed sql/add_backfill_progress.sql
+var addBackfillProgressSql string
+
+//go:embed sql/lock_backfill_progress.sql
+var lockBackfillProgressSql string
+
+//go:embed sql/get_users_after.sql
+var getUsersAfterSql string
+
+//go:embed sql/save_backfill_progress.sql
+var saveBackfillProgressSql string
+
+// SnapshotUsers пишет в outbox UserSnapshot для следующих limit пользователей после позиции backfill и сдвигает позицию
+// в той же транзакции. Строки пользователей блокируются на чтение, поэтому снимок встает в outbox строго до или после
+// их параллельных изменений. Возвращает число пользователей в снимке
+func (r Impl) SnapshotUsers(ctx context.Context, backfill string, limit int) (int, error) {
+	var count int
+	err := db.WithTx(ctx, r.db, func(ctx context.Context) error {
+		tx := r.conn(ctx)
+
+		if _, err := tx.ExecContext(ctx, addBackfillProgressSql, backfill); err != nil {
+			return err
+		}
+
+		var after uuid.UUID
+		if err := tx.GetContext(ctx, &after, lockBackfillProgressSql, backfill); err != nil {
+			return fmt.Errorf("could not lock backfill progress: %w", err)
+		}
+
+		users := make([]DbUser, 0, limit)
+		if err := tx.SelectContext(ctx, &users, getUsersAfterSql, after, limit); err != nil {
+			return err
+		}
+
+		count = len(users)
+		if count == 0 {
+			return nil
+		}
+
+		for _, user := range users {
+			if err := addOutboxEvent(ctx, tx, pkg.UserSnapshotType, user.Id.String(), userEvent(user)); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, saveBackfillProgressSql, backfill, users[len(users)-1].Id); err != nil {
+			return fmt.Errorf("could not save backfill progress: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+//go:embed sql/delete_backfill_progress.sql
+var deleteBackfillProgressSql string
+
+// ResetUserSnapshots возвращает backfill к первому пользователю
+func (r Impl) ResetUserSnapshots(ctx context.Context, backfill string) error {
+	_, err := r.db.ExecContext(ctx, deleteBackfillProgressSql, backfill)
+
+	return err
+}
@@ -0,0 +1,255 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+	"user-service/db"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReplayAddTicket      = "add_ticket"
+	ReplayTicketExists   = "ticket_exists"
+	ReplayUserNotFound   = "user_not_found"
+	ReplayTicketConflict = "ticket_conflict"
+)
+
+var ErrReplayReadOnly = errors.New("repository is read only in dry run")
+
+// ReplayChange изменение, которое повторная обработка сделала или сделала бы в режиме dry run
+type ReplayChange struct {
+	Action    string
+	MessageId string
+	UserId    uuid.UUID
+	TicketId  string
+}
+
+// ReplayRepository обертка для повторной обработки сообщений. Билеты добавляются в обход журнала
+// обработанных сообщений, уже существующие билеты пропускаются. В режиме dry run изменения только попадают в отчет
+type ReplayRepository struct {
+	Repository
+
+	dryRun  bool
+	mutex   *sync.Mutex
+	changes []ReplayChange
+}
+
+func NewReplayRepository(repository Repository, dryRun bool) *ReplayRepository {
+	return &ReplayRepository{
+		Repository: repository,
+		dryRun:     dryRun,
+		mutex:      &sync.Mutex{},
+	}
+}
+
+// Changes возвращает отчет об изменениях в порядке обработки
+func (r *ReplayRepository) Changes() []ReplayChange {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return slices.Clone(r.changes)
+}
+
+// WithTx передает в fn саму обертку, чтобы правила dry run действовали и внутри транзакции
+func (r *ReplayRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repository Repository) error, options ...db.TxOption) error {
+	return r.Repository.WithTx(ctx, func(ctx context.Context, _ Repository) error {
+		return fn(ctx, r)
+	}, options...)
+}
+
+func (r *ReplayRepository) AddUserTicket(ctx context.Context, userTicket DbUserTicket) error {
+	_, err := r.addTicket(ctx, "", userTicket)
+	return err
+}
+
+// AddUserTicketFromMessage не пишет в карантин: конфликт владения попадает только в отчет
+func (r *ReplayRepository) AddUserTicketFromMessage(ctx context.Context, message DbProcessedMessage, userTicket DbUserTicket) (bool, []DbTicketConflict, error) {
+	ok, err := r.addTicket(ctx, message.MessageId, userTicket)
+	return ok, nil, err
+}
+
+func (r *ReplayRepository) AddUserTickets(ctx context.Context, messages []DbProcessedMessage, userTickets []DbUserTicket) (int64, []DbTicketConflict, error) {
+	var added int64
+	for i, userTicket := range userTickets {
+		ok, err := r.addTicket(ctx, messages[i].MessageId, userTicket)
+		if err != nil {
+			return added, nil, err
+		}
+		if ok {
+			added++
+		}
+	}
+
+	return added, nil, nil
+}
+
+func (r *ReplayRepository) AddUser(ctx context.Context, user DbUser) (uuid.UUID, error) {
+	if r.dryRun {
+		return uuid.Nil, ErrReplayReadOnly
+	}
+
+	return r.Repository.AddUser(ctx, user)
+}
+
+func (r *ReplayRepository) UpdateUser(ctx context.Context, user DbUser) error {
+	if r.dryRun {
+		return ErrReplayReadOnly
+	}
+
+	return r.Repository.UpdateUser(ctx, user)
+}
+
+func (r *ReplayRepository) UpdateUserVerification(ctx context.Context, verification DbUserVerification) error {
+	if r.dryRun {
+		return ErrReplayReadOnly
+	}
+
+	return r.Repository.UpdateUserVerification(ctx, verification)
+}
+
+func (r *ReplayRepository) TransferUserTicket(ctx context.Context, transfer DbTicketTransfer) (DbTicketTransfer, error) {
+	if r.dryRun {
+		return DbTicketTransfer{}, ErrReplayReadOnly
+	}
+
+	return r.Repository.TransferUserTicket(ctx, transfer)
+}
+
+func (r *ReplayRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if r.dryRun {
+		return ErrReplayReadOnly
+	}
+
+	return r.Repository.DeleteUser(ctx, id)
+}
+
+// AddProcessedMessage не пишет в журнал: повторная обработка его не учитывает
+func (r *ReplayRepository) AddProcessedMessage(_ context.Context, _ DbProcessedMessage) (bool, error) {
+	return true, nil
+}
+
+// GetProcessedMessageIds ничего не возвращает: повторная обработка журнал не учитывает
+func (r *ReplayRepository) GetProcessedMessageIds(_ context.Context, _ string, _ []string) ([]string, error) {
+	return nil, nil
+}
+
+// AddBookingRejected не пишет в outbox: отказы повторной обработки только логируются
+func (r *ReplayRepository) AddBookingRejected(_ context.Context, _ DbBookingRejection) error {
+	return nil
+}
+
+func (r *ReplayRepository) AddPendingUserTicket(ctx context.Context, message DbProcessedMessage, ticket DbPendingUserTicket) (bool, error) {
+	if r.dryRun {
+		return false, ErrReplayReadOnly
+	}
+
+	return r.Repository.AddPendingUserTicket(ctx, message, ticket)
+}
+
+func (r *ReplayRepository) TakePendingUserTickets(ctx context.Context, userId uuid.UUID) ([]DbPendingUserTicket, error) {
+	if r.dryRun {
+		return nil, ErrReplayReadOnly
+	}
+
+	return r.Repository.TakePendingUserTickets(ctx, userId)
+}
+
+func (r *ReplayRepository) AttachUserTickets(ctx context.Context, tickets []DbPendingUserTicket) (int64, []DbTicketConflict, error) {
+	if r.dryRun {
+		return 0, nil, ErrReplayReadOnly
+	}
+
+	return r.Repository.AttachUserTickets(ctx, tickets)
+}
+
+func (r *ReplayRepository) DeletePendingUserTickets(ctx context.Context, before time.Time) ([]DbPendingUserTicket, error) {
+	if r.dryRun {
+		return nil, ErrReplayReadOnly
+	}
+
+	return r.Repository.DeletePendingUserTickets(ctx, before)
+}
+
+func (r *ReplayRepository) DeleteProcessedMessages(ctx context.Context, before time.Time) (int64, error) {
+	if r.dryRun {
+		return 0, ErrReplayReadOnly
+	}
+
+	return r.Repository.DeleteProcessedMessages(ctx, before)
+}
+
+func (r *ReplayRepository) SnapshotUsers(ctx context.Context, backfill string, limit int) (int, error) {
+	if r.dryRun {
+		return 0, ErrReplayReadOnly
+	}
+
+	return r.Repository.SnapshotUsers(ctx, backfill, limit)
+}
+
+func (r *ReplayRepository) ResetUserSnapshots(ctx context.Context, backfill string) error {
+	if r.dryRun {
+		return ErrReplayReadOnly
+	}
+
+	return r.Repository.ResetUserSnapshots(ctx, backfill)
+}
+
+// addTicket вставляет билет, только если predict обещает вставку: ошибка вставки прервала бы транзакцию сервиса,
+// в которой проверяется политика
+func (r *ReplayRepository) addTicket(ctx context.Context, messageId string, userTicket DbUserTicket) (bool, error) {
+	action, err := r.predict(ctx, userTicket)
+	if err != nil {
+		return false, err
+	}
+
+	if action == ReplayAddTicket && !r.dryRun {
+		if err = r.Repository.AddUserTicket(ctx, userTicket); err != nil {
+			return false, err
+		}
+	}
+
+	r.report(ReplayChange{
+		Action:    action,
+		MessageId: messageId,
+		UserId:    userTicket.UserId,
+		TicketId:  userTicket.TicketId,
+	})
+
+	return action == ReplayAddTicket, nil
+}
+
+// predict определяет, что произойдет со вставкой билета, не меняя данных
+func (r *ReplayRepository) predict(ctx context.Context, userTicket DbUserTicket) (string, error) {
+	if _, err := r.Repository.GetUserById(ctx, userTicket.UserId); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ReplayUserNotFound, nil
+		}
+
+		return "", err
+	}
+
+	owners, err := r.Repository.GetTicketOwners(ctx, []string{userTicket.TicketId})
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(owners) == 0:
+		return ReplayAddTicket, nil
+	case owners[0].UserId == userTicket.UserId:
+		return ReplayTicketExists, nil
+	default:
+		return ReplayTicketConflict, nil
+	}
+}
+
+func (r *ReplayRepository) report(change ReplayChange) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.changes = append(r.changes, change)
+}
@@ -2,16 +2,42 @@ package user
 
 import (
 	"context"
+	"time"
+	"user-service/db"
 
 	"github.com/google/uuid"
 )
 
 type Repository interface {
+	// WithTx выполняет fn в одной транзакции. Вложенные вызовы WithTx с ctx из fn присоединяются к ней
+	WithTx(ctx context.Context, fn func(ctx context.Context, repository Repository) error, options ...db.TxOption) error
+
 	GetUserById(ctx context.Context, id uuid.UUID) (DbUser, error)
+	GetUserByEmail(ctx context.Context, email string) (DbUser, error)
 	GetUsers(ctx context.Context) ([]DbUser, error)
+	// LockUsersByIds возвращает найденных пользователей и блокирует их до конца транзакции из ctx
+	LockUsersByIds(ctx context.Context, ids []uuid.UUID) ([]DbUser, error)
 	AddUser(ctx context.Context, user DbUser) (uuid.UUID, error)
 	UpdateUser(ctx context.Context, user DbUser) error
+	UpdateUserVerification(ctx context.Context, verification DbUserVerification) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
 	GetUserTicketsByUserId(ctx context.Context, userId uuid.UUID) ([]DbUserTicket, error)
+	CountUserTicketsByEvent(ctx context.Context, userId uuid.UUID, eventId, exceptTicketId string) (int, error)
 	AddUserTicket(ctx context.Context, userTicket DbUserTicket) error
+	GetTicketOwners(ctx context.Context, ticketIds []string) ([]DbUserTicket, error)
+	GetTicketConflicts(ctx context.Context, source string) ([]DbTicketConflict, error)
+	TransferUserTicket(ctx context.Context, transfer DbTicketTransfer) (DbTicketTransfer, error)
+	AddProcessedMessage(ctx context.Context, message DbProcessedMessage) (bool, error)
+	GetProcessedMessageIds(ctx context.Context, consumer string, messageIds []string) ([]string, error)
+	AddBookingRejected(ctx context.Context, rejection DbBookingRejection) error
+	AddUserTicketFromMessage(ctx context.Context, message DbProcessedMessage, userTicket DbUserTicket) (bool, []DbTicketConflict, error)
+	AddUserTickets(ctx context.Context, messages []DbProcessedMessage, userTickets []DbUserTicket) (int64, []DbTicketConflict, error)
+	AddPendingUserTicket(ctx context.Context, message DbProcessedMessage, ticket DbPendingUserTicket) (bool, error)
+	TakePendingUserTickets(ctx context.Context, userId uuid.UUID) ([]DbPendingUserTicket, error)
+	AttachUserTickets(ctx context.Context, tickets []DbPendingUserTicket) (int64, []DbTicketConflict, error)
+	DeletePendingUserTickets(ctx context.Context, before time.Time) ([]DbPendingUserTicket, error)
+	DeleteProcessedMessages(ctx context.Context, before time.Time) (int64, error)
+
+	SnapshotUsers(ctx context.Context, backfill string, limit int) (int, error)
+	ResetUserSnapshots(ctx context.Context, backfill string) error
 }
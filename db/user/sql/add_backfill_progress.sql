@@ -0,0 +1,3 @@
+insert into backfill_progress (name)
+values ($1)
+on conflict do nothing;
\ No newline at end of file
@@ -0,0 +1,2 @@
+insert into outbox (aggregate_id, event_type, payload)
+values ($1, $2, $3);
\ No newline at end of file
@@ -0,0 +1,3 @@
+insert into pending_user_tickets (user_id, ticket_id, event_id, message_id, min_age)
+values (:user_id, :ticket_id, :event_id, :message_id, :min_age)
+on conflict do nothing;
\ No newline at end of file
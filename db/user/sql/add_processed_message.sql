@@ -0,0 +1,3 @@
+insert into processed_messages (consumer, message_id)
+values (:consumer, :message_id)
+on conflict do nothing;
\ No newline at end of file
@@ -0,0 +1,4 @@
+insert into processed_messages (consumer, message_id)
+values (:consumer, :message_id)
+on conflict do nothing
+returning consumer, message_id;
\ No newline at end of file
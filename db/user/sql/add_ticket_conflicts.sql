@@ -0,0 +1,3 @@
+insert into ticket_ownership_conflicts (ticket_id, user_id, owner_user_id, message_id, source)
+values (:ticket_id, :user_id, :owner_user_id, :message_id, :source)
+returning id, ticket_id, user_id, owner_user_id, message_id, source, detected_at;
\ No newline at end of file
@@ -0,0 +1,3 @@
+insert into ticket_transfers (ticket_id, from_user_id, to_user_id, initiated_by)
+values (:ticket_id, :from_user_id, :to_user_id, :initiated_by)
+returning id, ticket_id, from_user_id, to_user_id, initiated_by, transferred_at;
\ No newline at end of file
@@ -1,3 +1,4 @@
-insert into users (email, name, surname)
-values (:email, :name, :surname)
-returning id;
\ No newline at end of file
+insert into users (id, email, name, surname, status, verified, birth_date)
+values (coalesce(nullif(:id, '00000000-0000-0000-0000-000000000000'::uuid), gen_random_uuid()), :email, :name, :surname,
+        coalesce(nullif(:status, ''), 'active'), :verified, :birth_date)
+returning id, email, name, surname, status, verified, birth_date;
\ No newline at end of file
@@ -1,2 +1,2 @@
-insert into user_tickets (user_id, ticket_id)
-values (:user_id, :ticket_id);
\ No newline at end of file
+insert into user_tickets (user_id, ticket_id, event_id)
+values (:user_id, :ticket_id, :event_id);
\ No newline at end of file
@@ -0,0 +1,4 @@
+insert into user_tickets (user_id, ticket_id, event_id)
+values (:user_id, :ticket_id, :event_id)
+on conflict do nothing
+returning user_id, ticket_id, event_id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+select count(*)
+from user_tickets ut
+where ut.user_id = $1
+  and ut.event_id = $2
+  and ut.ticket_id <> $3;
\ No newline at end of file
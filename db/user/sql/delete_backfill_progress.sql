@@ -0,0 +1,3 @@
+delete
+from backfill_progress
+where name = $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+delete
+from processed_messages
+where processed_at < $1;
\ No newline at end of file
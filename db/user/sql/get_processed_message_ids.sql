@@ -0,0 +1,4 @@
+select message_id
+from processed_messages
+where consumer = $1
+  and message_id = any ($2);
\ No newline at end of file
@@ -0,0 +1,10 @@
+select c.id            as id,
+       c.ticket_id     as ticket_id,
+       c.user_id       as user_id,
+       c.owner_user_id as owner_user_id,
+       c.message_id    as message_id,
+       c.source        as source,
+       c.detected_at   as detected_at
+from ticket_ownership_conflicts c
+where $1::text = '' or c.source = $1
+order by c.id;
\ No newline at end of file
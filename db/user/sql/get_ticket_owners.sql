@@ -0,0 +1,5 @@
+select ut.user_id   as user_id,
+       ut.ticket_id as ticket_id,
+       ut.event_id  as event_id
+from user_tickets ut
+where ut.ticket_id = any ($1);
\ No newline at end of file
@@ -1,5 +1,8 @@
-select u.id      as id,
-       u.email   as email,
-       u.name    as name,
-       u.surname as surname
+select u.id         as id,
+       u.email      as email,
+       u.name       as name,
+       u.surname    as surname,
+       u.status     as status,
+       u.verified   as verified,
+       u.birth_date as birth_date
 from users u;
\ No newline at end of file
@@ -0,0 +1,11 @@
+select u.id         as id,
+       u.email      as email,
+       u.name       as name,
+       u.surname    as surname,
+       u.status     as status,
+       u.verified   as verified,
+       u.birth_date as birth_date
+from users u
+where u.id > $1
+order by u.id
+limit $2 for share;
\ No newline at end of file
@@ -0,0 +1,3 @@
+select bp.last_user_id as last_user_id
+from backfill_progress bp
+where bp.name = $1 for update;
\ No newline at end of file
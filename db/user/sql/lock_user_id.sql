@@ -0,0 +1 @@
+select pg_advisory_xact_lock(hashtextextended($1::text, 0));
\ No newline at end of file
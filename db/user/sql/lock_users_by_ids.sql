@@ -0,0 +1,10 @@
+select u.id         as id,
+       u.email      as email,
+       u.name       as name,
+       u.surname    as surname,
+       u.status     as status,
+       u.verified   as verified,
+       u.birth_date as birth_date
+from users u
+where u.id = any ($1)
+order by u.id for update;
\ No newline at end of file
@@ -0,0 +1 @@
+select pg_notify($1, $2::text);
\ No newline at end of file
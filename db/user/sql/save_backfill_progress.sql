@@ -0,0 +1,4 @@
+update backfill_progress
+set last_user_id = $2,
+    updated_at   = now()
+where name = $1;
\ No newline at end of file
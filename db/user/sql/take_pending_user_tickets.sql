@@ -0,0 +1,4 @@
+delete
+from pending_user_tickets
+where user_id = $1
+returning user_id, ticket_id, event_id, message_id, min_age, created_at;
\ No newline at end of file
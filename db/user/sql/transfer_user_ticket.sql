@@ -0,0 +1,4 @@
+update user_tickets
+set user_id = :to_user_id
+where user_id = :from_user_id
+  and ticket_id = :ticket_id;
\ No newline at end of file
@@ -2,4 +2,5 @@ update users
 set email   = :email,
     name    = :name,
     surname = :surname
-where id = :id;
\ No newline at end of file
+where id = :id
+returning id, email, name, surname, status, verified, birth_date;
\ No newline at end of file
@@ -0,0 +1,6 @@
+update users
+set status     = coalesce(nullif(:status, ''), status),
+    verified   = :verified,
+    birth_date = :birth_date
+where id = :id
+returning id, email, name, surname, status, verified, birth_date;
\ No newline at end of file
@@ -0,0 +1 @@
+select exists(select 1 from users where id = $1);
\ No newline at end of file
@@ -46,6 +46,7 @@ const docTemplate = `{
                 }
             },
             "put": {
+                "description": "Меняет только Email, Name и Surname. Status, Verified и BirthDate задает админский PUT /users/{id}/verification",
                 "consumes": [
                     "application/json"
                 ],
@@ -86,10 +87,23 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             },
             "post": {
+                "description": "Id пользователя генерирует сервис, Id из тела запроса игнорируется.\nStatus, Verified и BirthDate из тела запроса игнорируются, их задает админский PUT /users/{id}/verification.\nПользователя с заданным Id, например для привязки отложенных бронирований, создает админский POST /users/import",
                 "consumes": [
                     "application/json"
                 ],
@@ -123,6 +137,12 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
@@ -201,6 +221,12 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
@@ -244,12 +270,114 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/user/{id}/tickets/{ticketId}/transfer": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Передает билет другому пользователю по ID или email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ticket ID",
+                        "name": "ticketId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Transfer",
+                        "name": "transfer",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg.TicketTransferRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/pkg.TicketTransfer"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "pkg.TicketTransfer": {
+            "type": "object",
+            "properties": {
+                "FromUserId": {
+                    "type": "string"
+                },
+                "Id": {
+                    "type": "string"
+                },
+                "InitiatedBy": {
+                    "type": "string"
+                },
+                "TicketId": {
+                    "type": "string"
+                },
+                "ToUserId": {
+                    "type": "string"
+                },
+                "TransferredAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "pkg.TicketTransferRequest": {
+            "type": "object",
+            "properties": {
+                "ToEmail": {
+                    "type": "string"
+                },
+                "ToUserId": {
+                    "type": "string"
+                }
+            }
+        },
         "pkg.User": {
             "type": "object",
             "properties": {
+                "BirthDate": {
+                    "type": "string"
+                },
                 "Email": {
                     "type": "string"
                 },
@@ -259,14 +387,23 @@ const docTemplate = `{
                 "Name": {
                     "type": "string"
                 },
+                "Status": {
+                    "type": "string"
+                },
                 "Surname": {
                     "type": "string"
+                },
+                "Verified": {
+                    "type": "boolean"
                 }
             }
         },
         "pkg.UserTicket": {
             "type": "object",
             "properties": {
+                "EventId": {
+                    "type": "string"
+                },
                 "TicketId": {
                     "type": "string"
                 },
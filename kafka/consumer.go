@@ -2,6 +2,9 @@ package kafka
 
 import (
 	"context"
+	gosync "sync"
+	"sync/atomic"
+	"time"
 	"user-service/ctx"
 	"user-service/sync"
 
@@ -9,65 +12,158 @@ import (
 	"go.uber.org/zap"
 )
 
-type Subscriber func(message Message, err error)
+// Subscriber обрабатывает сообщение. Смещение фиксируется, только если все подписчики вернули nil
+type Subscriber func(message Message, err error) error
 
 type Consumer interface {
 	Consume(ctx context.Context) (Message, error)
+	Commit(ctx context.Context, messages ...Message) error
 	Subscribe(s Subscriber)
+	SubscribeBatch(s BatchSubscriber)
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	Paused() bool
+	SeekOffset(ctx context.Context, topic string, partition int, offset int64) error
+	SeekTimestamp(ctx context.Context, topic string, partition int, at time.Time) (int64, error)
+	Lag(ctx context.Context) ([]PartitionLag, error)
 	Close(ctx context.Context) error
 }
 
 type ConsumerImpl struct {
-	reader   *kafka.Reader
+	brokers  []string
+	options  ConsumerOptions
+	reader   atomic.Pointer[kafka.Reader]
+	client   *kafka.Client
 	listener *listener
+
+	mutex  *gosync.Mutex
+	paused bool
 }
 
 func NewConsumer(log *zap.Logger, getContext ctx.ProvideWithCancel, brokers []string, options ...ConsumerOption) (*ConsumerImpl, error) {
-	reader, err := newKafkaReader(brokers, options)
+	opt := newConsumerOptions(options)
+
+	reader, err := newKafkaReader(brokers, opt)
 	if err != nil {
 		return nil, err
 	}
 
 	consumer := &ConsumerImpl{
-		reader: reader,
+		brokers: brokers,
+		options: opt,
+		client:  newKafkaClient(brokers, opt.Security),
+		mutex:   &gosync.Mutex{},
 	}
+	consumer.reader.Store(reader)
 
-	consumer.listener = newListener(log, func() (Message, error) {
-		listenerCtx, cancel := getContext()
-		defer cancel()
-
-		return consumer.Consume(listenerCtx)
-	})
+	consumer.listener = newConsumerListener(log, getContext, consumer, opt)
 
 	return consumer, nil
 }
 
 func (c *ConsumerImpl) Consume(ctx context.Context) (Message, error) {
-	return c.reader.ReadMessage(ctx)
+	return c.reader.Load().FetchMessage(ctx)
+}
+
+func (c *ConsumerImpl) Commit(ctx context.Context, messages ...Message) error {
+	if len(c.options.GroupId) == 0 {
+		return nil
+	}
+
+	return c.reader.Load().CommitMessages(ctx, messages...)
 }
 
 func (c *ConsumerImpl) Subscribe(s Subscriber) {
 	c.listener.add(s)
-	c.listener.start()
+	c.startListener()
+}
+
+// SubscribeBatch подписывает на пачки сообщений. Без WithBatch пачка всегда состоит из одного сообщения
+func (c *ConsumerImpl) SubscribeBatch(s BatchSubscriber) {
+	c.listener.addBatch(s)
+	c.startListener()
+}
+
+func (c *ConsumerImpl) startListener() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.paused {
+		c.listener.start()
+	}
 }
 
 func (c *ConsumerImpl) Close(ctx context.Context) error {
-	return sync.WaitContext(ctx, c.reader.Close)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.listener.stop()
+	if err := c.listener.wait(ctx); err != nil {
+		return err
+	}
+
+	if c.paused {
+		return nil
+	}
+
+	return sync.WaitContext(ctx, c.reader.Load().Close)
 }
 
-func newKafkaReader(brokers []string, options []ConsumerOption) (*kafka.Reader, error) {
+// newConsumerListener связывает слушатель с чтением и фиксацией смещений консьюмера
+func newConsumerListener(log *zap.Logger, getContext ctx.ProvideWithCancel, consumer Consumer, opt ConsumerOptions) *listener {
+	return newListener(log, func(stop context.Context) (Message, error) {
+		listenerCtx, cancel := getContext()
+		defer cancel()
+		defer context.AfterFunc(stop, cancel)()
+
+		return consumer.Consume(listenerCtx)
+	}, func(messages ...Message) error {
+		listenerCtx, cancel := getContext()
+		defer cancel()
+
+		return consumer.Commit(listenerCtx, messages...)
+	}, listenerOptions{
+		retry:       opt.Retry,
+		deadLetter:  newDeadLetterFunc(getContext, opt.DeadLetter),
+		workers:     opt.Workers,
+		maxInFlight: opt.MaxInFlight,
+		shardKey:    opt.ShardKey,
+		batchSize:   opt.BatchSize,
+		batchWait:   opt.BatchWait,
+	})
+}
+
+func newDeadLetterFunc(getContext ctx.ProvideWithCancel, producer Producer) func(Message) error {
+	if producer == nil {
+		return nil
+	}
+
+	return func(message Message) error {
+		deadLetterCtx, cancel := getContext()
+		defer cancel()
+
+		return producer.Produce(deadLetterCtx, message)
+	}
+}
+
+func newConsumerOptions(options []ConsumerOption) ConsumerOptions {
 	opt := ConsumerOptions{
-		Partition:     -1,
-		QueueCapacity: -1,
-		MinBytes:      -1,
-		MaxBytes:      -1,
-		StartOffset:   -1,
+		Partition:      -1,
+		QueueCapacity:  -1,
+		MinBytes:       -1,
+		MaxBytes:       -1,
+		CommitInterval: -1,
+		Retry:          DefaultRetryPolicy,
 	}
 
 	for _, o := range options {
 		opt = o(opt)
 	}
 
+	return opt
+}
+
+func newKafkaReader(brokers []string, opt ConsumerOptions) (*kafka.Reader, error) {
 	cfg := kafka.ReaderConfig{
 		Brokers: brokers,
 	}
@@ -78,6 +174,11 @@ func newKafkaReader(brokers []string, options []ConsumerOption) (*kafka.Reader,
 	if len(opt.TopicName) > 0 {
 		cfg.Topic = opt.TopicName
 	}
+	if len(opt.TopicNames) == 1 && len(cfg.Topic) == 0 {
+		cfg.Topic = opt.TopicNames[0]
+	} else if len(opt.TopicNames) > 1 {
+		cfg.GroupTopics = opt.TopicNames
+	}
 	if opt.Partition > -1 {
 		cfg.Partition = opt.Partition
 	}
@@ -90,9 +191,15 @@ func newKafkaReader(brokers []string, options []ConsumerOption) (*kafka.Reader,
 	if opt.MaxBytes > -1 {
 		cfg.MaxBytes = opt.MaxBytes
 	}
-	if opt.StartOffset > -1 {
+	if opt.StartOffset != 0 {
 		cfg.StartOffset = opt.StartOffset
 	}
+	if opt.CommitInterval > -1 {
+		cfg.CommitInterval = opt.CommitInterval
+	}
+	if opt.Security.enabled() {
+		cfg.Dialer = opt.Security.dialer()
+	}
 
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultBatchWait = 100 * time.Millisecond
+
+// BatchSubscriber обрабатывает пачку сообщений целиком. Смещения фиксируются после успешной обработки всей пачки
+type BatchSubscriber func(messages []Message) error
+
+// listenBatches собирает пачки до batchSize сообщений или до истечения batchWait с первого сообщения пачки.
+// Пачки обрабатываются последовательно, поэтому порядок сообщений в партиции сохраняется
+func (l *listener) listenBatches() {
+	fetched := make(chan Message)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go l.fetch(wg, fetched)
+	defer wg.Wait()
+
+	for l.subsRunning.Load() {
+		batch := make([]Message, 0, l.options.batchSize)
+
+		select {
+		case msg := <-fetched:
+			batch = append(batch, msg)
+		case <-l.ctx.Done():
+			return
+		}
+
+		if !l.collect(fetched, &batch) {
+			return
+		}
+
+		if l.processBatch(batch) {
+			l.commitBatch(batch)
+		}
+	}
+}
+
+func (l *listener) collect(fetched <-chan Message, batch *[]Message) bool {
+	timer := time.NewTimer(l.options.batchWait)
+	defer timer.Stop()
+
+	for len(*batch) < l.options.batchSize {
+		select {
+		case msg := <-fetched:
+			*batch = append(*batch, msg)
+		case <-timer.C:
+			return true
+		case <-l.ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *listener) fetch(wg *sync.WaitGroup, fetched chan<- Message) {
+	defer wg.Done()
+
+	for l.subsRunning.Load() {
+		msg, err := l.consume(l.ctx)
+		if err != nil {
+			if !l.subsRunning.Load() {
+				return
+			}
+
+			_ = l.broadcastMessage(msg, err)
+			continue
+		}
+
+		select {
+		case fetched <- msg:
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
+
+// processBatch доставляет пачку подписчикам с повторами по политике retry.
+// Если пачку не удалось обработать, она делится пополам, пока ядовитое сообщение не останется одно:
+// такое сообщение отправляется в dead letter, а остальные обрабатываются как обычно
+func (l *listener) processBatch(batch []Message) bool {
+	if len(batch) == 1 {
+		return l.process(batch[0])
+	}
+
+	for attempt := 1; l.subsRunning.Load(); attempt++ {
+		err := l.broadcastBatch(batch)
+		if err == nil {
+			return true
+		}
+
+		first, last := batch[0], batch[len(batch)-1]
+		fields := []zap.Field{
+			zap.Int("size", len(batch)),
+			zap.String("first_topic", first.Topic),
+			zap.Int64("first_offset", first.Offset),
+			zap.String("last_topic", last.Topic),
+			zap.Int64("last_offset", last.Offset),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		}
+
+		if IsPermanent(err) || l.options.retry.Exhausted(attempt) {
+			l.log.Warn("could not process batch, splitting", fields...)
+
+			middle := len(batch) / 2
+			return l.processBatch(batch[:middle]) && l.processBatch(batch[middle:])
+		}
+
+		backoff := l.options.retry.Backoff(attempt)
+		l.log.Warn(fmt.Sprintf("could not process batch, retry in %s", backoff), fields...)
+
+		if !l.sleep(backoff) {
+			return false
+		}
+	}
+
+	return false
+}
+
+// commitBatch фиксирует последнее смещение пачки в каждой партиции
+func (l *listener) commitBatch(batch []Message) {
+	last := make(map[topicPartition]Message)
+	for _, message := range batch {
+		key := topicPartition{topic: message.Topic, partition: message.Partition}
+		if current, ok := last[key]; !ok || current.Offset < message.Offset {
+			last[key] = message
+		}
+	}
+
+	messages := make([]Message, 0, len(last))
+	for _, message := range last {
+		messages = append(messages, message)
+	}
+
+	if err := l.commit(messages...); err != nil {
+		l.log.Error("could not commit batch", zap.Int("size", len(batch)), zap.Error(err))
+	}
+}
+
+func (l *listener) broadcastBatch(batch []Message) error {
+	l.subsMutex.Lock()
+	subs := l.subs
+	batchSubs := l.batchSubs
+	l.subsMutex.Unlock()
+
+	var errs []error
+	for _, s := range batchSubs {
+		errs = append(errs, l.sendBatch(s, batch))
+	}
+
+	for _, message := range batch {
+		for _, s := range subs {
+			errs = append(errs, l.sendMessage(s, message, nil))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *listener) sendBatch(s BatchSubscriber, batch []Message) (subErr error) {
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			l.log.Error("could not process batch", zap.Int("size", len(batch)), zap.Any("panic", panicErr))
+			subErr = fmt.Errorf("subscriber panicked: %v", panicErr)
+		}
+	}()
+
+	return s(batch)
+}
@@ -0,0 +1,369 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const clientTimeout = 10 * time.Second
+
+var (
+	ErrNotPaused        = errors.New("consumer must be paused")
+	ErrNoConsumerGroup  = errors.New("consumer has no group")
+	ErrUnknownPartition = errors.New("unknown partition")
+	ErrGroupActive      = errors.New("consumer group has active members, pause every replica before seeking")
+)
+
+// PartitionLag отставание консьюмера в партиции. Committed равен -1, если группа еще ничего не зафиксировала
+type PartitionLag struct {
+	Topic     string `json:"Topic"`
+	Partition int    `json:"Partition"`
+	Committed int64  `json:"Committed"`
+	End       int64  `json:"End"`
+	Lag       int64  `json:"Lag"`
+}
+
+func newKafkaClient(brokers []string, security Security) *kafka.Client {
+	client := &kafka.Client{
+		Addr:    kafka.TCP(brokers...),
+		Timeout: clientTimeout,
+	}
+
+	if security.enabled() {
+		client.Transport = security.transport()
+	}
+
+	return client
+}
+
+// Pause останавливает чтение, дожидается фиксации уже обработанных сообщений и выходит из группы.
+// Пауза действует только на эту реплику: партиции можно перемотать, когда на паузе все реплики группы
+func (c *ConsumerImpl) Pause(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.paused {
+		return nil
+	}
+
+	c.listener.stop()
+	if err := c.listener.wait(ctx); err != nil {
+		return fmt.Errorf("could not stop listener: %w", err)
+	}
+
+	if err := c.reader.Load().Close(); err != nil {
+		return fmt.Errorf("could not close reader: %w", err)
+	}
+
+	c.paused = true
+
+	return nil
+}
+
+// Resume заново входит в группу и продолжает чтение с зафиксированных смещений
+func (c *ConsumerImpl) Resume(_ context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.paused {
+		return nil
+	}
+
+	reader, err := newKafkaReader(c.brokers, c.options)
+	if err != nil {
+		return fmt.Errorf("could not create reader: %w", err)
+	}
+
+	c.reader.Store(reader)
+	c.paused = false
+
+	if c.listener.subscribed() {
+		c.listener.start()
+	}
+
+	return nil
+}
+
+func (c *ConsumerImpl) Paused() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.paused
+}
+
+// SeekOffset фиксирует для группы смещение партиции. FirstOffset и LastOffset перематывают в начало и конец.
+// Для группы доступно только на паузе и только когда в группе не осталось участников,
+// иначе брокер отклонит фиксацию вне поколения группы. Консьюмер без группы перематывает свою партицию сразу
+func (c *ConsumerImpl) SeekOffset(ctx context.Context, topic string, partition int, offset int64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.options.GroupId) == 0 {
+		if err := c.checkPartition(topic, partition); err != nil {
+			return err
+		}
+
+		return c.reader.Load().SetOffset(offset)
+	}
+
+	if err := c.checkSeek(ctx); err != nil {
+		return err
+	}
+
+	if offset < 0 {
+		offsets, err := c.listOffsets(ctx, topic, kafka.OffsetRequest{Partition: partition, Timestamp: offset})
+		if err != nil {
+			return err
+		}
+
+		offset = offsets.FirstOffset
+		if offset < 0 {
+			offset = offsets.LastOffset
+		}
+	}
+
+	return c.commitOffset(ctx, topic, partition, offset)
+}
+
+// SeekTimestamp перематывает партицию на первое сообщение не раньше at, а если таких нет - в конец.
+// Возвращает выбранное смещение
+func (c *ConsumerImpl) SeekTimestamp(ctx context.Context, topic string, partition int, at time.Time) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.options.GroupId) == 0 {
+		if err := c.checkPartition(topic, partition); err != nil {
+			return 0, err
+		}
+
+		reader := c.reader.Load()
+		if err := reader.SetOffsetAt(ctx, at); err != nil {
+			return 0, err
+		}
+
+		return reader.Offset(), nil
+	}
+
+	if err := c.checkSeek(ctx); err != nil {
+		return 0, err
+	}
+
+	offsets, err := c.listOffsets(ctx, topic, kafka.TimeOffsetOf(partition, at))
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int64(-1)
+	for candidate := range offsets.Offsets {
+		if candidate >= 0 && (offset < 0 || candidate < offset) {
+			offset = candidate
+		}
+	}
+
+	if offset < 0 {
+		offsets, err = c.listOffsets(ctx, topic, kafka.LastOffsetOf(partition))
+		if err != nil {
+			return 0, err
+		}
+
+		offset = offsets.LastOffset
+	}
+
+	return offset, c.commitOffset(ctx, topic, partition, offset)
+}
+
+// Lag возвращает отставание группы по всем партициям ее топиков
+func (c *ConsumerImpl) Lag(ctx context.Context) ([]PartitionLag, error) {
+	if len(c.options.GroupId) == 0 {
+		return c.readerLag()
+	}
+
+	metadata, err := c.client.Metadata(ctx, &kafka.MetadataRequest{Topics: c.options.topics()})
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch metadata: %w", err)
+	}
+
+	partitions := make(map[string][]int)
+	requests := make(map[string][]kafka.OffsetRequest)
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			return nil, fmt.Errorf("could not fetch metadata of %s: %w", topic.Name, topic.Error)
+		}
+
+		for _, partition := range topic.Partitions {
+			partitions[topic.Name] = append(partitions[topic.Name], partition.ID)
+			requests[topic.Name] = append(requests[topic.Name], kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+		}
+	}
+
+	committed, err := c.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: c.options.GroupId, Topics: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return nil, fmt.Errorf("could not fetch committed offsets: %w", committed.Error)
+	}
+
+	ends, err := c.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: requests})
+	if err != nil {
+		return nil, fmt.Errorf("could not list offsets: %w", err)
+	}
+
+	bounds := make(map[topicPartition]kafka.PartitionOffsets)
+	for topic, offsets := range ends.Topics {
+		for _, offset := range offsets {
+			if offset.Error != nil {
+				return nil, fmt.Errorf("could not list offsets of %s/%d: %w", topic, offset.Partition, offset.Error)
+			}
+
+			bounds[topicPartition{topic: topic, partition: offset.Partition}] = offset
+		}
+	}
+
+	var result []PartitionLag
+	for topic, offsets := range committed.Topics {
+		for _, offset := range offsets {
+			if offset.Error != nil {
+				return nil, fmt.Errorf("could not fetch committed offset of %s/%d: %w", topic, offset.Partition, offset.Error)
+			}
+
+			bound := bounds[topicPartition{topic: topic, partition: offset.Partition}]
+			result = append(result, PartitionLag{
+				Topic:     topic,
+				Partition: offset.Partition,
+				Committed: offset.CommittedOffset,
+				End:       bound.LastOffset,
+				Lag:       c.lag(offset.CommittedOffset, bound),
+			})
+		}
+	}
+
+	slices.SortFunc(result, func(a, b PartitionLag) int {
+		if a.Topic != b.Topic {
+			if a.Topic < b.Topic {
+				return -1
+			}
+
+			return 1
+		}
+
+		return a.Partition - b.Partition
+	})
+
+	return result, nil
+}
+
+// lag для партиции без зафиксированного смещения считается от точки старта группы
+func (c *ConsumerImpl) lag(committed int64, bound kafka.PartitionOffsets) int64 {
+	if committed < 0 {
+		if c.options.StartOffset == LastOffset {
+			return 0
+		}
+
+		committed = bound.FirstOffset
+	}
+
+	return max(bound.LastOffset-committed, 0)
+}
+
+func (c *ConsumerImpl) readerLag() ([]PartitionLag, error) {
+	stats := c.reader.Load().Stats()
+
+	partition, err := strconv.Atoi(stats.Partition)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse partition %q: %w", stats.Partition, err)
+	}
+
+	return []PartitionLag{{
+		Topic:     stats.Topic,
+		Partition: partition,
+		Committed: stats.Offset,
+		End:       stats.Offset + stats.Lag,
+		Lag:       stats.Lag,
+	}}, nil
+}
+
+func (c *ConsumerImpl) checkPartition(topic string, partition int) error {
+	if topic != c.options.topics()[0] || partition != max(c.options.Partition, 0) {
+		return fmt.Errorf("%w %s/%d", ErrUnknownPartition, topic, partition)
+	}
+
+	return nil
+}
+
+// checkSeek проверяет, что группа пуста: пауза одной реплики не освобождает партиции, занятые другими
+func (c *ConsumerImpl) checkSeek(ctx context.Context) error {
+	if len(c.options.GroupId) == 0 {
+		return ErrNoConsumerGroup
+	}
+	if !c.paused {
+		return ErrNotPaused
+	}
+
+	response, err := c.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{c.options.GroupId}})
+	if err != nil {
+		return fmt.Errorf("could not describe group: %w", err)
+	}
+
+	for _, group := range response.Groups {
+		if group.Error != nil {
+			return fmt.Errorf("could not describe group %s: %w", group.GroupID, group.Error)
+		}
+
+		if len(group.Members) > 0 {
+			return fmt.Errorf("%w: group %s has %d members", ErrGroupActive, group.GroupID, len(group.Members))
+		}
+	}
+
+	return nil
+}
+
+func (c *ConsumerImpl) listOffsets(ctx context.Context, topic string, request kafka.OffsetRequest) (kafka.PartitionOffsets, error) {
+	response, err := c.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: {request}},
+	})
+	if err != nil {
+		return kafka.PartitionOffsets{}, fmt.Errorf("could not list offsets: %w", err)
+	}
+
+	for _, offsets := range response.Topics[topic] {
+		if offsets.Partition != request.Partition {
+			continue
+		}
+		if offsets.Error != nil {
+			return kafka.PartitionOffsets{}, fmt.Errorf("could not list offsets of %s/%d: %w", topic, request.Partition, offsets.Error)
+		}
+
+		return offsets, nil
+	}
+
+	return kafka.PartitionOffsets{}, fmt.Errorf("%w %s/%d", ErrUnknownPartition, topic, request.Partition)
+}
+
+// commitOffset фиксирует смещение вне поколения группы, что брокер разрешает только пустой группе
+func (c *ConsumerImpl) commitOffset(ctx context.Context, topic string, partition int, offset int64) error {
+	response, err := c.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      c.options.GroupId,
+		GenerationID: -1,
+		Topics: map[string][]kafka.OffsetCommit{
+			topic: {{Partition: partition, Offset: offset}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not commit offset: %w", err)
+	}
+
+	for _, committed := range response.Topics[topic] {
+		if committed.Error != nil {
+			return fmt.Errorf("could not commit offset of %s/%d: %w", topic, committed.Partition, committed.Error)
+		}
+	}
+
+	return nil
+}
@@ -1,27 +1,82 @@
 package kafka
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+type listenerOptions struct {
+	retry       RetryPolicy
+	deadLetter  func(Message) error
+	workers     int
+	maxInFlight int
+	shardKey    func(Message) []byte
+	batchSize   int
+	batchWait   time.Duration
+}
+
 type listener struct {
 	log         *zap.Logger
-	consume     func() (Message, error)
+	consume     func(ctx context.Context) (Message, error)
+	commit      func(...Message) error
+	options     listenerOptions
 	subs        []Subscriber
+	batchSubs   []BatchSubscriber
 	subsMutex   *sync.Mutex
 	subsRunning *atomic.Bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	stopped     chan struct{}
+
+	offsets     *offsetTracker
+	committed   map[topicPartition]int64
+	commitMutex *sync.Mutex
 }
 
-func newListener(log *zap.Logger, consume func() (Message, error)) *listener {
+func newListener(log *zap.Logger, consume func(ctx context.Context) (Message, error), commit func(...Message) error, options listenerOptions) *listener {
+	if options.workers < 1 {
+		options.workers = 1
+	}
+	if options.maxInFlight < options.workers {
+		options.maxInFlight = options.workers
+	}
+	if options.shardKey == nil {
+		options.shardKey = MessageKey
+	}
+	if options.batchSize > 1 && options.batchWait <= 0 {
+		options.batchWait = defaultBatchWait
+	}
+	if options.batchSize > 1 && options.workers > 1 {
+		log.Warn("batch mode processes batches sequentially, workers are not used",
+			zap.Int("batch_size", options.batchSize), zap.Int("workers", options.workers))
+	}
+
 	return &listener{
 		log:         log,
 		consume:     consume,
+		commit:      commit,
+		options:     options,
 		subsMutex:   &sync.Mutex{},
 		subsRunning: &atomic.Bool{},
+		commitMutex: &sync.Mutex{},
+	}
+}
+
+// MessageKey возвращает ключ сообщения, а для сообщений без ключа - номер партиции
+func MessageKey(message Message) []byte {
+	if len(message.Key) > 0 {
+		return message.Key
 	}
+
+	return []byte(strconv.Itoa(message.Partition))
 }
 
 func (l *listener) start() {
@@ -29,39 +84,253 @@ func (l *listener) start() {
 		return
 	}
 
+	// после перемотки смещения могут уменьшиться, поэтому учет смещений начинается заново
+	l.offsets = newOffsetTracker()
+	l.committed = make(map[topicPartition]int64)
+
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.stopped = make(chan struct{})
 	l.subsRunning.Store(true)
 
-	go l.listen()
+	listen := l.listen
+	if l.options.batchSize > 1 {
+		listen = l.listenBatches
+	}
+
+	go func() {
+		defer close(l.stopped)
+		listen()
+	}()
 }
 
+// listen читает сообщения и раскладывает их по воркерам по ключу шардирования:
+// сообщения с одним ключом обрабатываются одним воркером в порядке чтения.
+// Количество сообщений в обработке ограничено maxInFlight
 func (l *listener) listen() {
+	inFlight := make(chan struct{}, l.options.maxInFlight)
+	shards := make([]chan Message, l.options.workers)
+
+	wg := &sync.WaitGroup{}
+	for i := range shards {
+		shards[i] = make(chan Message, l.options.maxInFlight)
+
+		wg.Add(1)
+		go l.work(wg, shards[i], inFlight)
+	}
+
+	defer func() {
+		for _, shard := range shards {
+			close(shard)
+		}
+
+		wg.Wait()
+	}()
+
 	for l.subsRunning.Load() {
-		msg, err := l.consume()
-		l.broadcastMessage(msg, err)
+		select {
+		case inFlight <- struct{}{}:
+		case <-l.ctx.Done():
+			return
+		}
+
+		msg, err := l.consume(l.ctx)
+		if err != nil {
+			<-inFlight
+			if !l.subsRunning.Load() {
+				return
+			}
+
+			_ = l.broadcastMessage(msg, err)
+			continue
+		}
+
+		l.offsets.track(msg)
+		shards[l.shard(msg)] <- msg
+	}
+}
+
+func (l *listener) work(wg *sync.WaitGroup, messages <-chan Message, inFlight <-chan struct{}) {
+	defer wg.Done()
+
+	for msg := range messages {
+		if l.process(msg) {
+			l.complete(msg)
+		}
+
+		<-inFlight
+	}
+}
+
+func (l *listener) shard(message Message) int {
+	if l.options.workers == 1 {
+		return 0
 	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write(l.options.shardKey(message))
+
+	return int(hash.Sum32() % uint32(l.options.workers))
 }
 
-func (l *listener) broadcastMessage(message Message, err error) {
+// process доставляет сообщение подписчикам с повторами по политике retry.
+// Неисправимые и исчерпавшие попытки сообщения отправляются в dead letter.
+// Возвращает false, если слушатель остановили до завершения обработки
+func (l *listener) process(message Message) bool {
+	for attempt := 1; l.subsRunning.Load(); attempt++ {
+		err := l.broadcastMessage(message, nil)
+		if err == nil {
+			return true
+		}
+
+		fields := []zap.Field{
+			zap.String("topic", message.Topic),
+			zap.Int("partition", message.Partition),
+			zap.Int64("offset", message.Offset),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		}
+
+		if IsPermanent(err) || l.options.retry.Exhausted(attempt) {
+			l.log.Error("could not process message, sending to dead letter", fields...)
+			return l.sendToDeadLetter(message, err, attempt)
+		}
+
+		backoff := l.options.retry.Backoff(attempt)
+		l.log.Warn(fmt.Sprintf("could not process message, retry in %s", backoff), fields...)
+
+		if !l.sleep(backoff) {
+			return false
+		}
+	}
+
+	return false
+}
+
+func (l *listener) sendToDeadLetter(message Message, err error, attempts int) bool {
+	if l.options.deadLetter == nil {
+		l.log.Error("dead letter is not configured, message dropped",
+			zap.String("topic", message.Topic),
+			zap.Int("partition", message.Partition),
+			zap.Int64("offset", message.Offset))
+		return true
+	}
+
+	deadLetterMessage := NewDeadLetterMessage(message, err, attempts)
+	for attempt := 1; l.subsRunning.Load(); attempt++ {
+		produceErr := l.options.deadLetter(deadLetterMessage)
+		if produceErr == nil {
+			return true
+		}
+
+		backoff := l.options.retry.Backoff(attempt)
+		l.log.Error(fmt.Sprintf("could not send message to dead letter, retry in %s", backoff), zap.Error(produceErr))
+
+		if !l.sleep(backoff) {
+			return false
+		}
+	}
+
+	return false
+}
+
+// complete фиксирует смещение, только если все предыдущие сообщения партиции тоже обработаны
+func (l *listener) complete(message Message) {
+	commitMessage, ok := l.offsets.complete(message)
+	if !ok {
+		return
+	}
+
+	l.commitMutex.Lock()
+	defer l.commitMutex.Unlock()
+
+	key := topicPartition{topic: commitMessage.Topic, partition: commitMessage.Partition}
+	if committed, ok := l.committed[key]; ok && committed >= commitMessage.Offset {
+		return
+	}
+
+	if err := l.commit(commitMessage); err != nil {
+		l.log.Error("could not commit message",
+			zap.String("topic", commitMessage.Topic),
+			zap.Int("partition", commitMessage.Partition),
+			zap.Int64("offset", commitMessage.Offset),
+			zap.Error(err))
+		return
+	}
+
+	l.committed[key] = commitMessage.Offset
+}
+
+func (l *listener) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-l.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (l *listener) broadcastMessage(message Message, err error) error {
 	l.subsMutex.Lock()
-	defer l.subsMutex.Unlock()
+	subs := l.subs
+	batchSubs := l.batchSubs
+	l.subsMutex.Unlock()
 
-	for _, s := range l.subs {
-		l.sendMessage(s, message, err)
+	var errs []error
+	for _, s := range subs {
+		errs = append(errs, l.sendMessage(s, message, err))
 	}
+
+	if err == nil {
+		for _, s := range batchSubs {
+			errs = append(errs, l.sendBatch(s, []Message{message}))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-func (l *listener) sendMessage(s Subscriber, message Message, err error) {
+func (l *listener) sendMessage(s Subscriber, message Message, err error) (subErr error) {
 	defer func() {
 		if panicErr := recover(); panicErr != nil {
 			l.log.Error("could not process message", zap.String("key", string(message.Key)), zap.Error(err), zap.Any("panic", panicErr))
+			subErr = fmt.Errorf("subscriber panicked: %v", panicErr)
 		}
 	}()
 
-	s(message, err)
+	return s(message, err)
 }
 
+// stop прерывает чтение и повторы. Сообщения, уже переданные подписчикам, дообрабатываются в фоне
 func (l *listener) stop() {
-	l.subsRunning.Store(false)
+	if !l.subsRunning.Swap(false) {
+		return
+	}
+
+	l.cancel()
+}
+
+// wait дожидается, пока остановленный слушатель зафиксирует смещения обработанных сообщений
+func (l *listener) wait(ctx context.Context) error {
+	if l.stopped == nil {
+		return nil
+	}
+
+	select {
+	case <-l.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *listener) subscribed() bool {
+	l.subsMutex.Lock()
+	defer l.subsMutex.Unlock()
+
+	return len(l.subs)+len(l.batchSubs) > 0
 }
 
 func (l *listener) add(s Subscriber) {
@@ -70,3 +339,10 @@ func (l *listener) add(s Subscriber) {
 
 	l.subs = append(l.subs, s)
 }
+
+func (l *listener) addBatch(s BatchSubscriber) {
+	l.subsMutex.Lock()
+	defer l.subsMutex.Unlock()
+
+	l.batchSubs = append(l.batchSubs, s)
+}
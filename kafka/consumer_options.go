@@ -1,13 +1,28 @@
 package kafka
 
+import (
+	"fmt"
+	"time"
+)
+
 type ConsumerOptions struct {
-	GroupId       string
-	TopicName     string
-	Partition     int
-	QueueCapacity int
-	MinBytes      int
-	MaxBytes      int
-	StartOffset   int64
+	GroupId        string
+	TopicName      string
+	TopicNames     []string
+	Partition      int
+	QueueCapacity  int
+	MinBytes       int
+	MaxBytes       int
+	StartOffset    int64
+	CommitInterval time.Duration
+	Retry          RetryPolicy
+	DeadLetter     Producer
+	Workers        int
+	MaxInFlight    int
+	ShardKey       func(Message) []byte
+	BatchSize      int
+	BatchWait      time.Duration
+	Security       Security
 }
 
 type ConsumerOption func(p ConsumerOptions) ConsumerOptions
@@ -26,6 +41,14 @@ func WithTopic(name string) ConsumerOption {
 	}
 }
 
+// WithTopics подписывает группу консьюмеров сразу на несколько топиков
+func WithTopics(names ...string) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.TopicNames = names
+		return p
+	}
+}
+
 func WithPartition(id int) ConsumerOption {
 	return func(p ConsumerOptions) ConsumerOptions {
 		p.Partition = id
@@ -60,3 +83,79 @@ func WithOffset(start int64) ConsumerOption {
 		return p
 	}
 }
+
+func WithCommitInterval(interval time.Duration) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.CommitInterval = interval
+		return p
+	}
+}
+
+func WithRetry(policy RetryPolicy) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.Retry = policy
+		return p
+	}
+}
+
+// WithDeadLetter задает продюсер, в который уходят сообщения, так и не обработанные после всех повторов
+func WithDeadLetter(producer Producer) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.DeadLetter = producer
+		return p
+	}
+}
+
+// WithWorkers задает количество воркеров и ограничение на число сообщений в обработке.
+// Порядок обработки сохраняется только для сообщений с одинаковым ключом шардирования
+func WithWorkers(workers, maxInFlight int) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.Workers = workers
+		p.MaxInFlight = maxInFlight
+		return p
+	}
+}
+
+// WithShardKey задает ключ, по которому сообщения распределяются между воркерами. По умолчанию - ключ сообщения
+func WithShardKey(shardKey func(Message) []byte) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.ShardKey = shardKey
+		return p
+	}
+}
+
+// WithBatch включает пакетный режим: подписчики получают до size сообщений, собранных не дольше wait.
+// В пакетном режиме пачки обрабатываются последовательно, воркеры не используются
+func WithBatch(size int, wait time.Duration) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.BatchSize = size
+		p.BatchWait = wait
+		return p
+	}
+}
+
+func WithConsumerSecurity(security Security) ConsumerOption {
+	return func(p ConsumerOptions) ConsumerOptions {
+		p.Security = security
+		return p
+	}
+}
+
+func ParseStartOffset(raw string) (int64, error) {
+	switch raw {
+	case "", "first":
+		return FirstOffset, nil
+	case "last":
+		return LastOffset, nil
+	default:
+		return 0, fmt.Errorf("unknown start offset %q", raw)
+	}
+}
+
+func (o ConsumerOptions) topics() []string {
+	if len(o.TopicNames) > 0 {
+		return o.TopicNames
+	}
+
+	return []string{o.TopicName}
+}
@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderDeadLetterError     = "x-dead-letter-error"
+	HeaderDeadLetterReason    = "x-dead-letter-reason"
+	HeaderDeadLetterAttempts  = "x-dead-letter-attempts"
+	HeaderDeadLetterTopic     = "x-dead-letter-source-topic"
+	HeaderDeadLetterPartition = "x-dead-letter-source-partition"
+	HeaderDeadLetterOffset    = "x-dead-letter-source-offset"
+
+	deadLetterHeaderPrefix = "x-dead-letter-"
+	redriveIdleTimeout     = 10 * time.Second
+)
+
+// NewDeadLetterMessage копирует исходное сообщение и добавляет заголовки с причиной ошибки и источником
+func NewDeadLetterMessage(message Message, err error, attempts int) Message {
+	headers := make([]kafka.Header, 0, len(message.Headers)+5)
+	for _, h := range message.Headers {
+		if !strings.HasPrefix(h.Key, deadLetterHeaderPrefix) {
+			headers = append(headers, h)
+		}
+	}
+
+	headers = append(headers,
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(err.Error())},
+		kafka.Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(message.Topic)},
+		kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(message.Partition))},
+		kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+	)
+
+	if reason, ok := RejectReason(err); ok {
+		headers = append(headers, kafka.Header{Key: HeaderDeadLetterReason, Value: []byte(reason)})
+	}
+
+	return Message{
+		Key:     message.Key,
+		Value:   message.Value,
+		Headers: headers,
+	}
+}
+
+// RestoreDeadLetterMessage убирает служебные заголовки dead letter и возвращает сообщение в исходный топик
+func RestoreDeadLetterMessage(message Message, defaultTopic string) Message {
+	topic := defaultTopic
+	if source, ok := HeaderValue(message, HeaderDeadLetterTopic); ok && len(source) > 0 {
+		topic = source
+	}
+
+	headers := make([]kafka.Header, 0, len(message.Headers))
+	for _, h := range message.Headers {
+		if !strings.HasPrefix(h.Key, deadLetterHeaderPrefix) {
+			headers = append(headers, h)
+		}
+	}
+
+	return Message{
+		Topic:   topic,
+		Key:     message.Key,
+		Value:   message.Value,
+		Headers: headers,
+	}
+}
+
+// Redriver переносит сообщения из dead letter топика обратно в топики, из которых они пришли.
+// Продюсер target должен быть создан без топика, сообщения без исходного топика уходят в defaultTopic
+type Redriver struct {
+	kafka        Kafka
+	log          *zap.Logger
+	source       string
+	groupId      string
+	defaultTopic string
+	target       Producer
+}
+
+func NewRedriver(kafka Kafka, log *zap.Logger, source, groupId, defaultTopic string, target Producer) *Redriver {
+	return &Redriver{
+		kafka:        kafka,
+		log:          log,
+		source:       source,
+		groupId:      groupId,
+		defaultTopic: defaultTopic,
+		target:       target,
+	}
+}
+
+// Redrive переносит не более limit сообщений и возвращает их количество.
+// Перенос заканчивается, если в течение redriveIdleTimeout не пришло ни одного сообщения
+func (r *Redriver) Redrive(ctx context.Context, limit int) (count int, err error) {
+	consumer, err := r.kafka.Consumer(r.log, func() (context.Context, context.CancelFunc) {
+		return context.WithCancel(ctx)
+	}, WithTopic(r.source), WithConsumerGroup(r.groupId))
+	if err != nil {
+		return 0, fmt.Errorf("could not create dead letter consumer: %w", err)
+	}
+
+	defer func() {
+		if closeErr := consumer.Close(context.WithoutCancel(ctx)); closeErr != nil {
+			r.log.Error("could not close dead letter consumer", zap.Error(closeErr))
+		}
+	}()
+
+	for limit <= 0 || count < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, redriveIdleTimeout)
+		message, err := consumer.Consume(fetchCtx)
+		cancel()
+
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return count, nil
+			}
+
+			return count, fmt.Errorf("could not read dead letter message: %w", err)
+		}
+
+		if err = r.target.Produce(ctx, RestoreDeadLetterMessage(message, r.defaultTopic)); err != nil {
+			return count, fmt.Errorf("could not redrive message: %w", err)
+		}
+
+		if err = consumer.Commit(ctx, message); err != nil {
+			return count, fmt.Errorf("could not commit dead letter message: %w", err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
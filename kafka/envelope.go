@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+const HeaderContentType = "content-type"
+
+const EnvelopeContentType = "application/vnd.user-service.envelope+json"
+
+// Envelope - стандартная обертка событий. Payload описывается JSON Schema, зарегистрированной для Type и Version
+type Envelope struct {
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	Id         string          `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Producer   string          `json:"producer"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type envelopeKey struct{}
+
+func NewEnvelopeMessage(key, messageType string, version int, producer string, payload any) (Message, error) {
+	return NewEnvelopeMessageAt(key, uuid.NewString(), time.Now(), messageType, version, producer, payload)
+}
+
+// NewEnvelopeMessageAt собирает конверт с заданными идентификатором и временем события.
+// Повторная отправка того же события, например из outbox, получает тот же message-id
+func NewEnvelopeMessageAt(key, id string, occurredAt time.Time, messageType string, version int, producer string, payload any) (Message, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, err
+	}
+
+	envelope := Envelope{
+		Type:       messageType,
+		Version:    version,
+		Id:         id,
+		OccurredAt: occurredAt.UTC(),
+		Producer:   producer,
+		Payload:    payloadBytes,
+	}
+
+	message, err := NewJSONMessage(key, envelope)
+	if err != nil {
+		return Message{}, err
+	}
+
+	message.Headers = []kafka.Header{
+		{Key: HeaderType, Value: []byte(messageType)},
+		{Key: HeaderMessageId, Value: []byte(envelope.Id)},
+		{Key: HeaderContentType, Value: []byte(EnvelopeContentType)},
+	}
+
+	return message, nil
+}
+
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	envelope, ok := ctx.Value(envelopeKey{}).(Envelope)
+	return envelope, ok
+}
@@ -1,6 +1,10 @@
 package kafka
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"user-service/ctx"
 
 	"github.com/segmentio/kafka-go"
@@ -9,25 +13,161 @@ import (
 
 type Message = kafka.Message
 
+type Header = kafka.Header
+
+type WriteErrors = kafka.WriteErrors
+
+const (
+	FirstOffset = kafka.FirstOffset
+	LastOffset  = kafka.LastOffset
+)
+
+const (
+	DriverKafka  = "kafka"
+	DriverMemory = "memory"
+)
+
+const (
+	cleanupPolicyConfig  = "cleanup.policy"
+	cleanupPolicyCompact = "compact"
+)
+
+// ErrTopicNotCompacted топик есть, но старые сообщения в нем удаляются по retention, а не сжимаются по ключу
+var ErrTopicNotCompacted = errors.New("topic is not compacted")
+
 type Kafka interface {
 	Producer(topicName string, options ...ProducerOption) Producer
 	Consumer(log *zap.Logger, getCtx ctx.ProvideWithCancel, options ...ConsumerOption) (Consumer, error)
+	Offsets(ctx context.Context, topic string) ([]PartitionOffsets, error)
+	// EnsureCompactedTopic создает сжимаемый топик, если его нет, и возвращает ErrTopicNotCompacted,
+	// если существующий топик не сжимается
+	EnsureCompactedTopic(ctx context.Context, topic string) error
+}
+
+// PartitionOffsets границы партиции: First - первое доступное сообщение, End - смещение следующего сообщения
+type PartitionOffsets struct {
+	Partition int
+	First     int64
+	End       int64
 }
 
 type KafkaImpl struct {
-	brokers []string
+	brokers  []string
+	security Security
 }
 
-func NewKafka(brokers []string) *KafkaImpl {
+func NewKafka(brokers []string, security Security) *KafkaImpl {
 	return &KafkaImpl{
-		brokers: brokers,
+		brokers:  brokers,
+		security: security,
 	}
 }
 
 func (k *KafkaImpl) Producer(topicName string, options ...ProducerOption) Producer {
-	return NewProducer(k.brokers, topicName, options...)
+	return NewProducer(k.brokers, topicName, append([]ProducerOption{WithProducerSecurity(k.security)}, options...)...)
 }
 
 func (k *KafkaImpl) Consumer(log *zap.Logger, getCtx ctx.ProvideWithCancel, options ...ConsumerOption) (Consumer, error) {
-	return NewConsumer(log, getCtx, k.brokers, options...)
+	return NewConsumer(log, getCtx, k.brokers, append([]ConsumerOption{WithConsumerSecurity(k.security)}, options...)...)
+}
+
+func (k *KafkaImpl) Offsets(ctx context.Context, topic string) ([]PartitionOffsets, error) {
+	client := newKafkaClient(k.brokers, k.security)
+
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch metadata: %w", err)
+	}
+
+	var requests []kafka.OffsetRequest
+	for _, metadataTopic := range metadata.Topics {
+		if metadataTopic.Error != nil {
+			return nil, fmt.Errorf("could not fetch metadata of %s: %w", topic, metadataTopic.Error)
+		}
+
+		for _, partition := range metadataTopic.Partitions {
+			requests = append(requests, kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+		}
+	}
+
+	response, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, fmt.Errorf("could not list offsets: %w", err)
+	}
+
+	result := make([]PartitionOffsets, 0, len(response.Topics[topic]))
+	for _, offsets := range response.Topics[topic] {
+		if offsets.Error != nil {
+			return nil, fmt.Errorf("could not list offsets of %s/%d: %w", topic, offsets.Partition, offsets.Error)
+		}
+
+		result = append(result, PartitionOffsets{
+			Partition: offsets.Partition,
+			First:     offsets.FirstOffset,
+			End:       offsets.LastOffset,
+		})
+	}
+
+	slices.SortFunc(result, func(a, b PartitionOffsets) int {
+		return a.Partition - b.Partition
+	})
+
+	return result, nil
+}
+
+// EnsureCompactedTopic создает топик с cleanup.policy=compact и числом партиций и фактором репликации по умолчанию
+// брокера. Без прав на создание топика проверяется только политика уже существующего
+func (k *KafkaImpl) EnsureCompactedTopic(ctx context.Context, topic string) error {
+	client := newKafkaClient(k.brokers, k.security)
+
+	created, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{
+		Topics: []kafka.TopicConfig{{
+			Topic:             topic,
+			NumPartitions:     -1,
+			ReplicationFactor: -1,
+			ConfigEntries:     []kafka.ConfigEntry{{ConfigName: cleanupPolicyConfig, ConfigValue: cleanupPolicyCompact}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("could not create topic %s: %w", topic, err)
+	}
+
+	switch err = created.Errors[topic]; {
+	case err == nil,
+		errors.Is(err, kafka.TopicAlreadyExists),
+		errors.Is(err, kafka.TopicAuthorizationFailed),
+		errors.Is(err, kafka.ClusterAuthorizationFailed):
+	default:
+		return fmt.Errorf("could not create topic %s: %w", topic, err)
+	}
+
+	described, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			ConfigNames:  []string{cleanupPolicyConfig},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("could not describe topic %s: %w", topic, err)
+	}
+
+	for _, resource := range described.Resources {
+		if resource.Error != nil {
+			return fmt.Errorf("could not describe topic %s: %w", topic, resource.Error)
+		}
+
+		for _, entry := range resource.ConfigEntries {
+			if entry.ConfigName != cleanupPolicyConfig {
+				continue
+			}
+			if entry.ConfigValue != cleanupPolicyCompact {
+				return fmt.Errorf("%w: %s has %s=%s", ErrTopicNotCompacted, topic, cleanupPolicyConfig, entry.ConfigValue)
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s has no %s", ErrTopicNotCompacted, topic, cleanupPolicyConfig)
 }
@@ -0,0 +1,268 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"user-service/ctx"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+const defaultMemoryPartitions = 1
+
+// MemoryKafka брокер в памяти для тестов и локальной разработки.
+// Топики создаются при первом обращении с числом партиций по умолчанию
+type MemoryKafka struct {
+	mutex      *sync.Mutex
+	partitions int
+	topics     map[string][][]Message
+	groups     map[string]*memoryGroup
+	balancer   Balancer
+	changed    chan struct{}
+}
+
+type memoryGroup struct {
+	committed  map[topicPartition]int64
+	members    []*MemoryConsumer
+	generation int
+}
+
+func NewMemoryKafka(partitions int) *MemoryKafka {
+	if partitions < 1 {
+		partitions = defaultMemoryPartitions
+	}
+
+	return &MemoryKafka{
+		mutex:      &sync.Mutex{},
+		partitions: partitions,
+		topics:     make(map[string][][]Message),
+		groups:     make(map[string]*memoryGroup),
+		balancer:   &kafka.Hash{},
+		changed:    make(chan struct{}),
+	}
+}
+
+func (m *MemoryKafka) Producer(topicName string, options ...ProducerOption) Producer {
+	return newMemoryProducer(m, topicName, newProducerOptions(options))
+}
+
+func (m *MemoryKafka) Consumer(log *zap.Logger, getCtx ctx.ProvideWithCancel, options ...ConsumerOption) (Consumer, error) {
+	return newMemoryConsumer(log, getCtx, m, newConsumerOptions(options))
+}
+
+func (m *MemoryKafka) Offsets(_ context.Context, topic string) ([]PartitionOffsets, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	partitions := m.topicLocked(topic)
+	result := make([]PartitionOffsets, 0, len(partitions))
+	for partition, messages := range partitions {
+		result = append(result, PartitionOffsets{
+			Partition: partition,
+			First:     0,
+			End:       int64(len(messages)),
+		})
+	}
+
+	return result, nil
+}
+
+// EnsureCompactedTopic создает топик. Сообщения в памяти не удаляются, поэтому политика хранения не проверяется
+func (m *MemoryKafka) EnsureCompactedTopic(_ context.Context, topic string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.topicLocked(topic)
+
+	return nil
+}
+
+// CreateTopic создает топик с заданным числом партиций. Существующий топик не меняется
+func (m *MemoryKafka) CreateTopic(topic string, partitions int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.topics[topic]; ok {
+		return
+	}
+
+	m.topics[topic] = make([][]Message, max(partitions, 1))
+}
+
+// Publish записывает сообщения в топик, распределяя их по партициям хешем ключа
+func (m *MemoryKafka) Publish(topic string, messages ...Message) []Message {
+	return m.publish(topic, m.balancer, messages...)
+}
+
+// Messages возвращает сообщения всех партиций топика в порядке партиций и смещений
+func (m *MemoryKafka) Messages(topic string) []Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var result []Message
+	for _, partition := range m.topics[topic] {
+		result = append(result, partition...)
+	}
+
+	return result
+}
+
+// WaitMessages ждет, пока в топике наберется не меньше count сообщений, например в dead letter
+func (m *MemoryKafka) WaitMessages(ctx context.Context, topic string, count int) ([]Message, error) {
+	for {
+		m.mutex.Lock()
+		var result []Message
+		for _, partition := range m.topics[topic] {
+			result = append(result, partition...)
+		}
+		changed := m.changed
+		m.mutex.Unlock()
+
+		if len(result) >= count {
+			return result, nil
+		}
+
+		if err := m.wait(ctx, changed); err != nil {
+			return result, fmt.Errorf("got %d of %d messages in %s: %w", len(result), count, topic, err)
+		}
+	}
+}
+
+// WaitConsumed ждет, пока группа зафиксирует смещения всех сообщений топика
+func (m *MemoryKafka) WaitConsumed(ctx context.Context, groupId, topic string) error {
+	for {
+		m.mutex.Lock()
+		pending := m.pendingLocked(groupId, topic)
+		changed := m.changed
+		m.mutex.Unlock()
+
+		if pending == 0 {
+			return nil
+		}
+
+		if err := m.wait(ctx, changed); err != nil {
+			return fmt.Errorf("group %s has %d pending messages in %s: %w", groupId, pending, topic, err)
+		}
+	}
+}
+
+func (m *MemoryKafka) pendingLocked(groupId, topic string) int64 {
+	group := m.groups[groupId]
+
+	var pending int64
+	for partition, messages := range m.topics[topic] {
+		committed := int64(0)
+		if group != nil {
+			committed = group.committed[topicPartition{topic: topic, partition: partition}]
+		}
+
+		pending += max(int64(len(messages))-committed, 0)
+	}
+
+	return pending
+}
+
+func (m *MemoryKafka) publish(topic string, balancer Balancer, messages ...Message) []Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	partitions := m.topicLocked(topic)
+	ids := make([]int, len(partitions))
+	for i := range ids {
+		ids[i] = i
+	}
+
+	published := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		partition := balancer.Balance(message, ids...)
+
+		message.Topic = topic
+		message.Partition = partition
+		message.Offset = int64(len(partitions[partition]))
+		if message.Time.IsZero() {
+			message.Time = time.Now()
+		}
+
+		partitions[partition] = append(partitions[partition], message)
+		published = append(published, message)
+	}
+
+	m.notifyLocked()
+
+	return published
+}
+
+func (m *MemoryKafka) topicLocked(topic string) [][]Message {
+	partitions, ok := m.topics[topic]
+	if !ok {
+		partitions = make([][]Message, m.partitions)
+		m.topics[topic] = partitions
+	}
+
+	return partitions
+}
+
+func (m *MemoryKafka) groupLocked(groupId string) *memoryGroup {
+	group, ok := m.groups[groupId]
+	if !ok {
+		group = &memoryGroup{committed: make(map[topicPartition]int64)}
+		m.groups[groupId] = group
+	}
+
+	return group
+}
+
+// assignmentLocked раздает участникам группы партиции ее топиков по кругу
+func (m *MemoryKafka) assignmentLocked(group *memoryGroup, consumer *MemoryConsumer, topics []string) []topicPartition {
+	var all []topicPartition
+	for _, topic := range topics {
+		for partition := range m.topicLocked(topic) {
+			all = append(all, topicPartition{topic: topic, partition: partition})
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].topic != all[j].topic {
+			return all[i].topic < all[j].topic
+		}
+
+		return all[i].partition < all[j].partition
+	})
+
+	member := -1
+	for i, candidate := range group.members {
+		if candidate == consumer {
+			member = i
+		}
+	}
+	if member < 0 {
+		return nil
+	}
+
+	var assigned []topicPartition
+	for i, partition := range all {
+		if i%len(group.members) == member {
+			assigned = append(assigned, partition)
+		}
+	}
+
+	return assigned
+}
+
+func (m *MemoryKafka) notifyLocked() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *MemoryKafka) wait(ctx context.Context, changed <-chan struct{}) error {
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
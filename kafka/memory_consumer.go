@@ -0,0 +1,390 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"user-service/ctx"
+
+	"go.uber.org/zap"
+)
+
+// MemoryConsumer консьюмер брокера в памяти. Участники одной группы делят партиции ее топиков,
+// при входе и выходе участника позиции перечитываются из зафиксированных смещений
+type MemoryConsumer struct {
+	broker   *MemoryKafka
+	options  ConsumerOptions
+	listener *listener
+
+	controlMutex *sync.Mutex
+
+	// поля ниже защищены мьютексом брокера
+	positions  map[topicPartition]int64
+	generation int
+	next       int
+	paused     bool
+	closed     bool
+}
+
+func newMemoryConsumer(log *zap.Logger, getContext ctx.ProvideWithCancel, broker *MemoryKafka, opt ConsumerOptions) (*MemoryConsumer, error) {
+	if len(opt.GroupId) == 0 && len(opt.TopicNames) > 1 {
+		return nil, ErrNoConsumerGroup
+	}
+
+	consumer := &MemoryConsumer{
+		broker:       broker,
+		options:      opt,
+		controlMutex: &sync.Mutex{},
+		positions:    make(map[topicPartition]int64),
+	}
+
+	broker.mutex.Lock()
+	consumer.joinLocked()
+	broker.mutex.Unlock()
+
+	consumer.listener = newConsumerListener(log, getContext, consumer, opt)
+
+	return consumer, nil
+}
+
+func (c *MemoryConsumer) Consume(ctx context.Context) (Message, error) {
+	for {
+		c.broker.mutex.Lock()
+		if c.paused || c.closed {
+			c.broker.mutex.Unlock()
+			return Message{}, io.EOF
+		}
+
+		message, ok := c.fetchLocked()
+		changed := c.broker.changed
+		c.broker.mutex.Unlock()
+
+		if ok {
+			return message, nil
+		}
+
+		if err := c.broker.wait(ctx, changed); err != nil {
+			return Message{}, err
+		}
+	}
+}
+
+func (c *MemoryConsumer) Commit(_ context.Context, messages ...Message) error {
+	if len(c.options.GroupId) == 0 {
+		return nil
+	}
+
+	c.broker.mutex.Lock()
+	defer c.broker.mutex.Unlock()
+
+	group := c.broker.groupLocked(c.options.GroupId)
+	for _, message := range messages {
+		key := topicPartition{topic: message.Topic, partition: message.Partition}
+		if group.committed[key] < message.Offset+1 {
+			group.committed[key] = message.Offset + 1
+		}
+	}
+
+	c.broker.notifyLocked()
+
+	return nil
+}
+
+func (c *MemoryConsumer) Subscribe(s Subscriber) {
+	c.listener.add(s)
+	c.startListener()
+}
+
+func (c *MemoryConsumer) SubscribeBatch(s BatchSubscriber) {
+	c.listener.addBatch(s)
+	c.startListener()
+}
+
+func (c *MemoryConsumer) startListener() {
+	c.controlMutex.Lock()
+	defer c.controlMutex.Unlock()
+
+	if !c.Paused() {
+		c.listener.start()
+	}
+}
+
+func (c *MemoryConsumer) Pause(ctx context.Context) error {
+	c.controlMutex.Lock()
+	defer c.controlMutex.Unlock()
+
+	if c.Paused() {
+		return nil
+	}
+
+	c.listener.stop()
+	if err := c.listener.wait(ctx); err != nil {
+		return err
+	}
+
+	c.broker.mutex.Lock()
+	defer c.broker.mutex.Unlock()
+
+	c.leaveLocked()
+	c.paused = true
+	c.broker.notifyLocked()
+
+	return nil
+}
+
+func (c *MemoryConsumer) Resume(_ context.Context) error {
+	c.controlMutex.Lock()
+	defer c.controlMutex.Unlock()
+
+	c.broker.mutex.Lock()
+	if !c.paused {
+		c.broker.mutex.Unlock()
+		return nil
+	}
+
+	c.paused = false
+	c.joinLocked()
+	c.broker.mutex.Unlock()
+
+	if c.listener.subscribed() {
+		c.listener.start()
+	}
+
+	return nil
+}
+
+func (c *MemoryConsumer) Paused() bool {
+	c.broker.mutex.Lock()
+	defer c.broker.mutex.Unlock()
+
+	return c.paused
+}
+
+func (c *MemoryConsumer) SeekOffset(_ context.Context, topic string, partition int, offset int64) error {
+	c.broker.mutex.Lock()
+	defer c.broker.mutex.Unlock()
+
+	if err := c.checkSeekLocked(topic, partition); err != nil {
+		return err
+	}
+
+	messages := c.broker.topicLocked(topic)
+	switch {
+	case partition < 0 || partition >= len(messages):
+		return ErrUnknownPartition
+	case offset == FirstOffset:
+		offset = 0
+	case offset == LastOffset:
+		offset = int64(len(messages[partition]))
+	}
+
+	c.seekLocked(topicPartition{topic: topic, partition: partition}, offset)
+
+	return nil
+}
+
+func (c *MemoryConsumer) SeekTimestamp(_ context.Context, topic string, partition int, at time.Time) (int64, error) {
+	c.broker.mutex.Lock()
+	defer c.broker.mutex.Unlock()
+
+	if err := c.checkSeekLocked(topic, partition); err != nil {
+		return 0, err
+	}
+
+	partitions := c.broker.topicLocked(topic)
+	if partition < 0 || partition >= len(partitions) {
+		return 0, ErrUnknownPartition
+	}
+
+	offset := int64(len(partitions[partition]))
+	for _, message := range partitions[partition] {
+		if !message.Time.Before(at) {
+			offset = message.Offset
+			break
+		}
+	}
+
+	c.seekLocked(topicPartition{topic: topic, partition: partition}, offset)
+
+	return offset, nil
+}
+
+func (c *MemoryConsumer) Lag(_ context.Context) ([]PartitionLag, error) {
+	c.broker.mutex.Lock()
+	defer c.broker.mutex.Unlock()
+
+	var result []PartitionLag
+	for _, topic := range c.options.topics() {
+		for partition, messages := range c.broker.topicLocked(topic) {
+			key := topicPartition{topic: topic, partition: partition}
+			end := int64(len(messages))
+
+			committed, ok := int64(-1), false
+			if len(c.options.GroupId) > 0 {
+				committed, ok = c.broker.groupLocked(c.options.GroupId).committed[key]
+			} else if partition == c.partition() {
+				committed, ok = c.positions[key]
+			} else {
+				continue
+			}
+
+			position := committed
+			if !ok {
+				committed, position = -1, c.startLocked(key)
+			}
+
+			result = append(result, PartitionLag{
+				Topic:     topic,
+				Partition: partition,
+				Committed: committed,
+				End:       end,
+				Lag:       max(end-position, 0),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func (c *MemoryConsumer) Close(ctx context.Context) error {
+	c.controlMutex.Lock()
+	defer c.controlMutex.Unlock()
+
+	c.listener.stop()
+	if err := c.listener.wait(ctx); err != nil {
+		return err
+	}
+
+	c.broker.mutex.Lock()
+	defer c.broker.mutex.Unlock()
+
+	if !c.paused {
+		c.leaveLocked()
+	}
+	c.closed = true
+	c.broker.notifyLocked()
+
+	return nil
+}
+
+// checkSeekLocked повторяет ограничения ConsumerImpl: группу можно перематывать только на паузе
+// и без активных участников, а консьюмер без группы - только в пределах своей партиции
+func (c *MemoryConsumer) checkSeekLocked(topic string, partition int) error {
+	if len(c.options.GroupId) == 0 {
+		if topic != c.options.topics()[0] || partition != c.partition() {
+			return ErrUnknownPartition
+		}
+
+		return nil
+	}
+	if !c.paused {
+		return ErrNotPaused
+	}
+	if members := len(c.broker.groupLocked(c.options.GroupId).members); members > 0 {
+		return fmt.Errorf("%w: group %s has %d members", ErrGroupActive, c.options.GroupId, members)
+	}
+
+	return nil
+}
+
+func (c *MemoryConsumer) seekLocked(key topicPartition, offset int64) {
+	if len(c.options.GroupId) == 0 {
+		c.positions[key] = offset
+		return
+	}
+
+	c.broker.groupLocked(c.options.GroupId).committed[key] = offset
+}
+
+// fetchLocked по кругу обходит назначенные партиции и возвращает первое непрочитанное сообщение
+func (c *MemoryConsumer) fetchLocked() (Message, bool) {
+	assigned := c.assignedLocked()
+
+	for i := range assigned {
+		index := (c.next + i) % len(assigned)
+		key := assigned[index]
+
+		position, ok := c.positions[key]
+		if !ok {
+			position = c.startLocked(key)
+		}
+
+		messages := c.broker.topics[key.topic][key.partition]
+		if position >= int64(len(messages)) {
+			c.positions[key] = position
+			continue
+		}
+
+		c.positions[key] = position + 1
+		c.next = index + 1
+
+		return messages[position], true
+	}
+
+	return Message{}, false
+}
+
+func (c *MemoryConsumer) assignedLocked() []topicPartition {
+	if len(c.options.GroupId) == 0 {
+		topic := c.options.topics()[0]
+		if c.partition() >= len(c.broker.topicLocked(topic)) {
+			return nil
+		}
+
+		return []topicPartition{{topic: topic, partition: c.partition()}}
+	}
+
+	group := c.broker.groupLocked(c.options.GroupId)
+	if group.generation != c.generation {
+		c.positions = make(map[topicPartition]int64)
+		c.generation = group.generation
+	}
+
+	return c.broker.assignmentLocked(group, c, c.options.topics())
+}
+
+// startLocked возвращает позицию чтения партиции без позиции: зафиксированное смещение группы или точку старта
+func (c *MemoryConsumer) startLocked(key topicPartition) int64 {
+	if len(c.options.GroupId) > 0 {
+		if committed, ok := c.broker.groupLocked(c.options.GroupId).committed[key]; ok {
+			return committed
+		}
+	}
+
+	if c.options.StartOffset == LastOffset {
+		return int64(len(c.broker.topicLocked(key.topic)[key.partition]))
+	}
+
+	return 0
+}
+
+func (c *MemoryConsumer) partition() int {
+	return max(c.options.Partition, 0)
+}
+
+func (c *MemoryConsumer) joinLocked() {
+	if len(c.options.GroupId) == 0 {
+		return
+	}
+
+	group := c.broker.groupLocked(c.options.GroupId)
+	group.members = append(group.members, c)
+	group.generation++
+}
+
+func (c *MemoryConsumer) leaveLocked() {
+	if len(c.options.GroupId) == 0 {
+		return
+	}
+
+	group := c.broker.groupLocked(c.options.GroupId)
+	for i, member := range group.members {
+		if member == c {
+			group.members = append(group.members[:i], group.members[i+1:]...)
+			group.generation++
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MemoryProducer продюсер брокера в памяти. Запись синхронная, Completion вызывается сразу после нее
+type MemoryProducer struct {
+	broker     *MemoryKafka
+	topic      string
+	serializer Serializer
+	headers    []Header
+	balancer   Balancer
+	completion func(messages []Message, err error)
+}
+
+func newMemoryProducer(broker *MemoryKafka, topic string, opt ProducerOptions) *MemoryProducer {
+	balancer := opt.Balancer
+	if balancer == nil {
+		balancer = &kafka.RoundRobin{}
+	}
+
+	return &MemoryProducer{
+		broker:     broker,
+		topic:      topic,
+		serializer: opt.Serializer,
+		headers:    opt.Headers,
+		balancer:   balancer,
+		completion: opt.Completion,
+	}
+}
+
+// Produce как и kafka.Writer отклоняет все сообщения, если у одного из них неверно задан топик
+func (p *MemoryProducer) Produce(_ context.Context, messages ...Message) error {
+	topics := make([]string, 0, len(messages))
+	for _, message := range messages {
+		topic := p.topic
+		switch {
+		case len(topic) > 0 && len(message.Topic) > 0:
+			return errors.New("kafka.(*Writer): Topic must not be specified for both Writer and Message")
+		case len(topic) == 0 && len(message.Topic) == 0:
+			return errors.New("kafka.(*Writer): Topic must be specified for Writer or Message")
+		case len(topic) == 0:
+			topic = message.Topic
+		}
+
+		topics = append(topics, topic)
+	}
+
+	published := make([]Message, 0, len(messages))
+	for i, message := range messages {
+		message.Headers = withDefaultHeaders(message.Headers, p.headers)
+		published = append(published, p.broker.publish(topics[i], p.balancer, message)...)
+	}
+
+	if p.completion != nil && len(published) > 0 {
+		p.completion(published, nil)
+	}
+
+	return nil
+}
+
+func (p *MemoryProducer) ProduceValue(ctx context.Context, key string, value any, headers ...Header) error {
+	data, err := p.serializer.Serialize(ctx, p.topic, value)
+	if err != nil {
+		return fmt.Errorf("could not serialize message: %w", err)
+	}
+
+	return p.Produce(ctx, Message{
+		Key:     []byte(key),
+		Value:   data,
+		Headers: headers,
+	})
+}
+
+func (p *MemoryProducer) Close(_ context.Context) error {
+	return nil
+}
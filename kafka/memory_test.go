@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	testTopic       = "Orders"
+	testDeadLetter  = "Orders.DLQ"
+	testGroup       = "orders-service"
+	testMessageType = "Order"
+)
+
+type testOrder struct {
+	Id    string `json:"Id"`
+	Count int    `json:"Count"`
+}
+
+// TestMemoryRouter проводит сообщения через брокер в памяти, консьюмер группы и роутер:
+// корректные сообщения доходят до обработчика, а нарушающие схему уходят в dead letter
+func TestMemoryRouter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	log := zap.NewNop()
+	broker := NewMemoryKafka(2)
+
+	schemas := NewSchemas()
+	err := schemas.Register(testMessageType, 1, []byte(`{
+		"type": "object",
+		"required": ["Id", "Count"],
+		"properties": {"Id": {"type": "string"}, "Count": {"type": "integer", "minimum": 1}}
+	}`), nil)
+	if err != nil {
+		t.Fatalf("could not register schema: %v", err)
+	}
+
+	mutex := &sync.Mutex{}
+	handled := make(map[string]int)
+
+	router := NewRouter()
+	router.Use(Recoverer(log), Validate(schemas))
+	router.MapTopic(testTopic, testMessageType)
+	HandleJSON(router, testMessageType, func(_ context.Context, _ Message, order testOrder) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		handled[order.Id] += order.Count
+		return nil
+	})
+
+	consumer, err := broker.Consumer(log, func() (context.Context, context.CancelFunc) {
+		return context.WithCancel(ctx)
+	},
+		WithTopic(testTopic),
+		WithConsumerGroup(testGroup),
+		WithOffset(FirstOffset),
+		WithRetry(RetryPolicy{MaxAttempts: 1}),
+		WithDeadLetter(broker.Producer(testDeadLetter)),
+	)
+	if err != nil {
+		t.Fatalf("could not create consumer: %v", err)
+	}
+	defer func() {
+		_ = consumer.Close(context.Background())
+	}()
+
+	consumer.Subscribe(router.Subscriber(ctx, log))
+
+	broker.Publish(testTopic,
+		Message{Key: []byte("a"), Value: []byte(`{"Id":"a","Count":1}`)},
+		Message{Key: []byte("b"), Value: []byte(`{"Id":"b","Count":2}`)},
+		Message{Key: []byte("a"), Value: []byte(`{"Id":"a","Count":3}`)},
+		Message{Key: []byte("c"), Value: []byte(`{"Id":"c","Count":0}`)},
+	)
+
+	if err = broker.WaitConsumed(ctx, testGroup, testTopic); err != nil {
+		t.Fatalf("messages were not consumed: %v", err)
+	}
+
+	mutex.Lock()
+	if handled["a"] != 4 || handled["b"] != 2 || len(handled) != 2 {
+		t.Errorf("unexpected handled orders: %v", handled)
+	}
+	mutex.Unlock()
+
+	deadLetters, err := broker.WaitMessages(ctx, testDeadLetter, 1)
+	if err != nil {
+		t.Fatalf("message was not dead lettered: %v", err)
+	}
+
+	if reason, _ := HeaderValue(deadLetters[0], HeaderDeadLetterReason); reason != ReasonSchemaViolation {
+		t.Errorf("got dead letter reason %q, want %q", reason, ReasonSchemaViolation)
+	}
+}
@@ -1,6 +1,11 @@
 package kafka
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const HeaderMessageId = "message-id"
 
 func NewJSONMessage(key string, data any) (Message, error) {
 	jsonBytes, err := json.Marshal(data)
@@ -13,3 +18,22 @@ func NewJSONMessage(key string, data any) (Message, error) {
 		Value: jsonBytes,
 	}, nil
 }
+
+// MessageId возвращает идентификатор из заголовка message-id, а если его нет - topic/partition/offset
+func MessageId(message Message) string {
+	if id, ok := HeaderValue(message, HeaderMessageId); ok && len(id) > 0 {
+		return id
+	}
+
+	return fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)
+}
+
+func HeaderValue(message Message, key string) (string, bool) {
+	for i := len(message.Headers) - 1; i >= 0; i-- {
+		if message.Headers[i].Key == key {
+			return string(message.Headers[i].Value), true
+		}
+	}
+
+	return "", false
+}
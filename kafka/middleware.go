@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const HeaderTraceParent = "traceparent"
+
+var messageMetrics = expvar.NewMap("kafka_messages")
+
+type traceIdKey struct{}
+
+// Recoverer превращает панику обработчика в ошибку, чтобы сообщение ушло на повтор
+func Recoverer(log *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, message Message) (err error) {
+			defer func() {
+				if panicErr := recover(); panicErr != nil {
+					log.Error("message handler panicked",
+						zap.String("type", MessageTypeFromContext(ctx)),
+						zap.String("topic", message.Topic),
+						zap.Any("panic", panicErr),
+						zap.StackSkip("stack", 2))
+					err = fmt.Errorf("message handler panicked: %v", panicErr)
+				}
+			}()
+
+			return next(ctx, message)
+		}
+	}
+}
+
+func Logger(log *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, message Message) error {
+			start := time.Now()
+			err := next(ctx, message)
+
+			fields := []zap.Field{
+				zap.String("type", MessageTypeFromContext(ctx)),
+				zap.String("topic", message.Topic),
+				zap.Int("partition", message.Partition),
+				zap.Int64("offset", message.Offset),
+				zap.Duration("duration", time.Since(start)),
+			}
+			if traceId := TraceIdFromContext(ctx); len(traceId) > 0 {
+				fields = append(fields, zap.String("trace_id", traceId))
+			}
+
+			if err != nil {
+				log.Error("could not handle message", append(fields, zap.Error(err))...)
+				return err
+			}
+
+			log.Debug("handled message", fields...)
+			return nil
+		}
+	}
+}
+
+// Metrics считает обработанные и неуспешные сообщения по типам в expvar kafka_messages
+func Metrics() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, message Message) error {
+			start := time.Now()
+			err := next(ctx, message)
+
+			messageType := MessageTypeFromContext(ctx)
+			if len(messageType) == 0 {
+				messageType = "unknown"
+			}
+
+			messageMetrics.Add(messageType+".processed", 1)
+			messageMetrics.Add(messageType+".duration_ms", time.Since(start).Milliseconds())
+			if err != nil {
+				messageMetrics.Add(messageType+".failed", 1)
+			}
+
+			return err
+		}
+	}
+}
+
+// Tracing достает trace id из заголовка traceparent (W3C Trace Context) или создает новый
+func Tracing() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, message Message) error {
+			traceId := ""
+			if traceParent, ok := HeaderValue(message, HeaderTraceParent); ok {
+				parts := strings.Split(traceParent, "-")
+				if len(parts) == 4 && len(parts[1]) == 32 {
+					traceId = parts[1]
+				}
+			}
+
+			if len(traceId) == 0 {
+				traceId = newTraceId()
+			}
+
+			return next(context.WithValue(ctx, traceIdKey{}, traceId), message)
+		}
+	}
+}
+
+func TraceIdFromContext(ctx context.Context) string {
+	traceId, _ := ctx.Value(traceIdKey{}).(string)
+	return traceId
+}
+
+// Retry повторяет обработку внутри обработчика, не отдавая сообщение обратно слушателю
+func Retry(policy RetryPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, message Message) error {
+			for attempt := 1; ; attempt++ {
+				err := next(ctx, message)
+				if err == nil || IsPermanent(err) || policy.Exhausted(attempt) {
+					return err
+				}
+
+				timer := time.NewTimer(policy.Backoff(attempt))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+func newTraceId() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
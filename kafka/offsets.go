@@ -0,0 +1,80 @@
+package kafka
+
+import "sync"
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+type partitionOffsets struct {
+	pending []int64
+	done    map[int64]struct{}
+}
+
+// offsetTracker следит за сообщениями в обработке и отдает смещение,
+// до которого все сообщения партиции обработаны без пропусков
+type offsetTracker struct {
+	mutex      *sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		mutex:      &sync.Mutex{},
+		partitions: make(map[topicPartition]*partitionOffsets),
+	}
+}
+
+func (t *offsetTracker) track(message Message) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := topicPartition{topic: message.Topic, partition: message.Partition}
+
+	offsets, ok := t.partitions[key]
+	if !ok || (len(offsets.pending) > 0 && offsets.pending[len(offsets.pending)-1] >= message.Offset) {
+		// После ребалансировки партиция может начаться заново с зафиксированного смещения
+		offsets = &partitionOffsets{done: make(map[int64]struct{})}
+		t.partitions[key] = offsets
+	}
+
+	offsets.pending = append(offsets.pending, message.Offset)
+}
+
+// complete отмечает сообщение обработанным и возвращает сообщение, смещение которого можно зафиксировать
+func (t *offsetTracker) complete(message Message) (Message, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := topicPartition{topic: message.Topic, partition: message.Partition}
+
+	offsets, ok := t.partitions[key]
+	if !ok || len(offsets.pending) == 0 || message.Offset < offsets.pending[0] {
+		return Message{}, false
+	}
+
+	offsets.done[message.Offset] = struct{}{}
+
+	committed := int64(-1)
+	for len(offsets.pending) > 0 {
+		head := offsets.pending[0]
+		if _, isDone := offsets.done[head]; !isDone {
+			break
+		}
+
+		delete(offsets.done, head)
+		offsets.pending = offsets.pending[1:]
+		committed = head
+	}
+
+	if committed < 0 {
+		return Message{}, false
+	}
+
+	return Message{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    committed,
+	}, true
+}
@@ -2,44 +2,154 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"user-service/sync"
 
 	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
 )
 
+var produceMetrics = expvar.NewMap("kafka_produce")
+
 type Producer interface {
-	Produce(ctx context.Context, message Message) error
+	// Produce отправляет сообщения одной записью. Если часть сообщений не отправлена, возвращает WriteErrors,
+	// ошибки по сообщениям разбирает ProduceErrors
+	Produce(ctx context.Context, messages ...Message) error
+	ProduceValue(ctx context.Context, key string, value any, headers ...Header) error
 	Close(ctx context.Context) error
 }
 
 type ProducerImpl struct {
-	writer *kafka.Writer
+	writer     *kafka.Writer
+	serializer Serializer
+	headers    []Header
 }
 
 func NewProducer(brokers []string, topic string, options ...ProducerOption) *ProducerImpl {
+	opt := newProducerOptions(options)
+
 	return &ProducerImpl{
-		writer: newKafkaWriter(brokers, topic, options),
+		writer:     newKafkaWriter(brokers, topic, opt),
+		serializer: opt.Serializer,
+		headers:    opt.Headers,
 	}
 }
 
-func (p *ProducerImpl) Produce(ctx context.Context, message Message) error {
-	return p.writer.WriteMessages(ctx, message)
+func (p *ProducerImpl) Produce(ctx context.Context, messages ...Message) error {
+	withHeaders := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		message.Headers = withDefaultHeaders(message.Headers, p.headers)
+		withHeaders = append(withHeaders, message)
+	}
+
+	return p.writer.WriteMessages(ctx, withHeaders...)
+}
+
+// ProduceValue сериализует value сериализатором продюсера и отправляет в топик продюсера
+func (p *ProducerImpl) ProduceValue(ctx context.Context, key string, value any, headers ...Header) error {
+	data, err := p.serializer.Serialize(ctx, p.writer.Topic, value)
+	if err != nil {
+		return fmt.Errorf("could not serialize message: %w", err)
+	}
+
+	return p.Produce(ctx, Message{
+		Key:     []byte(key),
+		Value:   data,
+		Headers: headers,
+	})
 }
 
 func (p *ProducerImpl) Close(ctx context.Context) error {
 	return sync.WaitContext(ctx, p.writer.Close)
 }
 
-func newKafkaWriter(brokers []string, topic string, options []ProducerOption) *kafka.Writer {
+// ProduceErrors раскладывает ошибку Produce по count отправленным сообщениям. Ошибка не WriteErrors относится ко всем
+func ProduceErrors(err error, count int) []error {
+	errs := make([]error, count)
+	if err == nil {
+		return errs
+	}
+
+	var writeErrs WriteErrors
+	if errors.As(err, &writeErrs) && len(writeErrs) == count {
+		copy(errs, writeErrs)
+		return errs
+	}
+
+	for i := range errs {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// LogCompletion логирует ошибки асинхронной отправки и считает отправленные и потерянные сообщения по топикам
+// в expvar kafka_produce
+func LogCompletion(log *zap.Logger) func(messages []Message, err error) {
+	return func(messages []Message, err error) {
+		for _, message := range messages {
+			if err != nil {
+				produceMetrics.Add(message.Topic+".failed", 1)
+				continue
+			}
+
+			produceMetrics.Add(message.Topic+".produced", 1)
+		}
+
+		if err != nil {
+			log.Error("could not produce messages", zap.Int("count", len(messages)), zap.Error(err))
+		}
+	}
+}
+
+func withDefaultHeaders(headers, defaults []Header) []Header {
+	if len(defaults) == 0 {
+		return headers
+	}
+
+	result := make([]Header, 0, len(headers)+len(defaults))
+	result = append(result, headers...)
+
+	for _, header := range defaults {
+		if !hasHeader(headers, header.Key) {
+			result = append(result, header)
+		}
+	}
+
+	return result
+}
+
+func hasHeader(headers []Header, key string) bool {
+	for _, header := range headers {
+		if header.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newProducerOptions(options []ProducerOption) ProducerOptions {
 	opt := ProducerOptions{
-		BatchSize:  -1,
-		BatchBytes: -1,
+		BatchSize:       -1,
+		BatchBytes:      -1,
+		MaxAttempts:     -1,
+		WriteBackoffMin: -1,
+		WriteBackoffMax: -1,
+		WriteTimeout:    -1,
+		Serializer:      NewJSONSerializer(nil),
 	}
 
 	for _, o := range options {
 		opt = o(opt)
 	}
 
+	return opt
+}
+
+func newKafkaWriter(brokers []string, topic string, opt ProducerOptions) *kafka.Writer {
 	writer := &kafka.Writer{
 		Addr:  kafka.TCP(brokers...),
 		Topic: topic,
@@ -51,6 +161,30 @@ func newKafkaWriter(brokers []string, topic string, options []ProducerOption) *k
 	if opt.BatchBytes > 0 {
 		writer.BatchBytes = opt.BatchBytes
 	}
+	if opt.BatchTimeout > 0 {
+		writer.BatchTimeout = opt.BatchTimeout
+	}
+	if opt.MaxAttempts > 0 {
+		writer.MaxAttempts = opt.MaxAttempts
+	}
+	if opt.WriteBackoffMin > -1 {
+		writer.WriteBackoffMin = opt.WriteBackoffMin
+	}
+	if opt.WriteBackoffMax > -1 {
+		writer.WriteBackoffMax = opt.WriteBackoffMax
+	}
+	if opt.WriteTimeout > -1 {
+		writer.WriteTimeout = opt.WriteTimeout
+	}
+	if opt.Balancer != nil {
+		writer.Balancer = opt.Balancer
+	}
+	if opt.Security.enabled() {
+		writer.Transport = opt.Security.transport()
+	}
+	writer.RequiredAcks = opt.RequiredAcks
+	writer.Compression = opt.Compression
 	writer.Async = opt.Async
+	writer.Completion = opt.Completion
 	return writer
 }
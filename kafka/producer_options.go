@@ -1,9 +1,42 @@
 package kafka
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+type (
+	RequiredAcks = kafka.RequiredAcks
+	Compression  = kafka.Compression
+	Balancer     = kafka.Balancer
+)
+
+const (
+	RequireNone = kafka.RequireNone
+	RequireOne  = kafka.RequireOne
+	RequireAll  = kafka.RequireAll
+)
+
 type ProducerOptions struct {
-	BatchSize  int
-	BatchBytes int64
-	Async      bool
+	BatchSize       int
+	BatchBytes      int64
+	BatchTimeout    time.Duration
+	Async           bool
+	Completion      func(messages []Message, err error)
+	Serializer      Serializer
+	Security        Security
+	RequiredAcks    RequiredAcks
+	Compression     Compression
+	MaxAttempts     int
+	WriteBackoffMin time.Duration
+	WriteBackoffMax time.Duration
+	WriteTimeout    time.Duration
+	Balancer        Balancer
+	Headers         []Header
 }
 
 type ProducerOption func(p ProducerOptions) ProducerOptions
@@ -22,9 +55,142 @@ func WithBatchBytes(bytes int64) ProducerOption {
 	}
 }
 
-func ProduceAsync() ProducerOption {
+// WithBatchTimeout задает, сколько неполная пачка ждет новых сообщений перед отправкой. По умолчанию kafka-go ждет секунду,
+// и синхронный Produce отвечает не раньше
+func WithBatchTimeout(timeout time.Duration) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.BatchTimeout = timeout
+		return p
+	}
+}
+
+// ProduceAsync включает асинхронную отправку. Пока не задан WithCompletion, результат обрабатывает LogCompletion(log)
+func ProduceAsync(log *zap.Logger) ProducerOption {
 	return func(p ProducerOptions) ProducerOptions {
 		p.Async = true
+		if p.Completion == nil {
+			p.Completion = LogCompletion(log)
+		}
+		return p
+	}
+}
+
+// WithCompletion задает обработчик результата асинхронной отправки вместо LogCompletion
+func WithCompletion(completion func(messages []Message, err error)) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.Completion = completion
+		return p
+	}
+}
+
+// WithRequiredAcks задает число подтверждений от реплик. По умолчанию RequireNone
+func WithRequiredAcks(acks RequiredAcks) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.RequiredAcks = acks
+		return p
+	}
+}
+
+func WithCompression(compression Compression) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.Compression = compression
 		return p
 	}
 }
+
+// WithWriteRetry задает число попыток записи и границы паузы между ними
+func WithWriteRetry(maxAttempts int, backoffMin, backoffMax time.Duration) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.MaxAttempts = maxAttempts
+		p.WriteBackoffMin = backoffMin
+		p.WriteBackoffMax = backoffMax
+		return p
+	}
+}
+
+func WithWriteTimeout(timeout time.Duration) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.WriteTimeout = timeout
+		return p
+	}
+}
+
+// WithBalancer задает распределение сообщений по партициям. По умолчанию - round-robin
+func WithBalancer(balancer Balancer) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.Balancer = balancer
+		return p
+	}
+}
+
+// WithHeaders добавляет заголовки ко всем сообщениям продюсера, если в сообщении нет заголовка с тем же ключом
+func WithHeaders(headers ...Header) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.Headers = append(p.Headers, headers...)
+		return p
+	}
+}
+
+// WithSerializer задает сериализатор для ProduceValue. По умолчанию - обычный JSON
+func WithSerializer(serializer Serializer) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.Serializer = serializer
+		return p
+	}
+}
+
+func WithProducerSecurity(security Security) ProducerOption {
+	return func(p ProducerOptions) ProducerOptions {
+		p.Security = security
+		return p
+	}
+}
+
+func ParseRequiredAcks(raw string) (RequiredAcks, error) {
+	switch strings.ToLower(raw) {
+	case "", "none":
+		return RequireNone, nil
+	case "one", "leader":
+		return RequireOne, nil
+	case "all":
+		return RequireAll, nil
+	default:
+		return 0, fmt.Errorf("unknown required acks %q", raw)
+	}
+}
+
+func ParseCompression(raw string) (Compression, error) {
+	switch strings.ToLower(raw) {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %q", raw)
+	}
+}
+
+// ParseBalancer разбирает hash (FNV-1a по ключу), crc32 (как в librdkafka), murmur2 (как в Java-клиенте)
+// и round_robin. Пустая строка оставляет round-robin по умолчанию
+func ParseBalancer(raw string) (Balancer, error) {
+	switch strings.ToLower(raw) {
+	case "":
+		return nil, nil
+	case "round_robin":
+		return &kafka.RoundRobin{}, nil
+	case "hash":
+		return &kafka.Hash{}, nil
+	case "crc32":
+		return kafka.CRC32Balancer{}, nil
+	case "murmur2":
+		return kafka.Murmur2Balancer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancer %q", raw)
+	}
+}
@@ -0,0 +1,159 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJSON     = "JSON"
+)
+
+var ErrSchemaNotFound = errors.New("schema not found")
+
+type RegisteredSchema struct {
+	Id         int
+	Subject    string
+	Version    int
+	SchemaType string
+	Schema     string
+}
+
+// SchemaRegistry - клиент реестра схем, совместимого с Confluent Schema Registry
+type SchemaRegistry interface {
+	SchemaById(ctx context.Context, id int) (RegisteredSchema, error)
+	Latest(ctx context.Context, subject string) (RegisteredSchema, error)
+	Register(ctx context.Context, subject, schemaType, schema string) (int, error)
+}
+
+// MemorySchemaRegistry хранит схемы в памяти процесса. Подходит для тестов и локальной разработки
+type MemorySchemaRegistry struct {
+	mutex    *sync.RWMutex
+	byId     map[int]RegisteredSchema
+	subjects map[string][]RegisteredSchema
+	nextId   int
+}
+
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{
+		mutex:    &sync.RWMutex{},
+		byId:     make(map[int]RegisteredSchema),
+		subjects: make(map[string][]RegisteredSchema),
+		nextId:   1,
+	}
+}
+
+func (r *MemorySchemaRegistry) SchemaById(_ context.Context, id int) (RegisteredSchema, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	schema, ok := r.byId[id]
+	if !ok {
+		return RegisteredSchema{}, fmt.Errorf("%w: id %d", ErrSchemaNotFound, id)
+	}
+
+	return schema, nil
+}
+
+func (r *MemorySchemaRegistry) Latest(_ context.Context, subject string) (RegisteredSchema, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return RegisteredSchema{}, fmt.Errorf("%w: subject %s", ErrSchemaNotFound, subject)
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+// Register возвращает id уже зарегистрированной схемы, если subject содержит такую же
+func (r *MemorySchemaRegistry) Register(_ context.Context, subject, schemaType, schema string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, registered := range r.subjects[subject] {
+		if registered.Schema == schema && registered.SchemaType == schemaType {
+			return registered.Id, nil
+		}
+	}
+
+	registered := RegisteredSchema{
+		Id:         r.nextId,
+		Subject:    subject,
+		Version:    len(r.subjects[subject]) + 1,
+		SchemaType: schemaType,
+		Schema:     schema,
+	}
+
+	r.nextId++
+	r.byId[registered.Id] = registered
+	r.subjects[subject] = append(r.subjects[subject], registered)
+
+	return registered.Id, nil
+}
+
+var schemaTypesByExtension = map[string]string{
+	".avsc":  SchemaTypeAvro,
+	".proto": SchemaTypeProtobuf,
+	".json":  SchemaTypeJSON,
+}
+
+// NewFileSchemaRegistry загружает схемы из каталога вида <dir>/<subject>/<version>.<avsc|proto|json>.
+// Версии регистрируются по возрастанию, поэтому id стабильны между запусками
+func NewFileSchemaRegistry(dir string) (*MemorySchemaRegistry, error) {
+	registry := NewMemorySchemaRegistry()
+
+	subjects, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema registry dir: %w", err)
+	}
+
+	for _, subject := range subjects {
+		if !subject.IsDir() {
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, subject.Name(), "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Slice(files, func(i, j int) bool {
+			return versionOf(files[i]) < versionOf(files[j])
+		})
+
+		for _, file := range files {
+			schemaType, ok := schemaTypesByExtension[filepath.Ext(file)]
+			if !ok {
+				continue
+			}
+
+			schema, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err = registry.Register(context.Background(), subject.Name(), schemaType, string(schema)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+func versionOf(file string) int {
+	var version int
+	_, _ = fmt.Sscanf(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), "%d", &version)
+
+	return version
+}
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	registryContentType = "application/vnd.schemaregistry.v1+json"
+	registryTimeout     = 10 * time.Second
+)
+
+// HTTPSchemaRegistry - клиент REST API Confluent Schema Registry. Схемы по id кэшируются навсегда, они неизменяемы
+type HTTPSchemaRegistry struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	mutex *sync.RWMutex
+	byId  map[int]RegisteredSchema
+}
+
+func NewHTTPSchemaRegistry(baseURL, username, password string) *HTTPSchemaRegistry {
+	return &HTTPSchemaRegistry{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: registryTimeout},
+		mutex:    &sync.RWMutex{},
+		byId:     make(map[int]RegisteredSchema),
+	}
+}
+
+type registrySchemaResponse struct {
+	Subject    string `json:"subject"`
+	Id         int    `json:"id"`
+	Version    int    `json:"version"`
+	SchemaType string `json:"schemaType"`
+	Schema     string `json:"schema"`
+}
+
+type registryRegisterRequest struct {
+	SchemaType string `json:"schemaType,omitempty"`
+	Schema     string `json:"schema"`
+}
+
+type registryRegisterResponse struct {
+	Id int `json:"id"`
+}
+
+type registryErrorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func (r *HTTPSchemaRegistry) SchemaById(ctx context.Context, id int) (RegisteredSchema, error) {
+	r.mutex.RLock()
+	schema, ok := r.byId[id]
+	r.mutex.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	var response registrySchemaResponse
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &response); err != nil {
+		return RegisteredSchema{}, err
+	}
+
+	schema = RegisteredSchema{
+		Id:         id,
+		SchemaType: schemaTypeOrDefault(response.SchemaType),
+		Schema:     response.Schema,
+	}
+
+	r.mutex.Lock()
+	r.byId[id] = schema
+	r.mutex.Unlock()
+
+	return schema, nil
+}
+
+func (r *HTTPSchemaRegistry) Latest(ctx context.Context, subject string) (RegisteredSchema, error) {
+	var response registrySchemaResponse
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/subjects/%s/versions/latest", url.PathEscape(subject)), nil, &response); err != nil {
+		return RegisteredSchema{}, err
+	}
+
+	return RegisteredSchema{
+		Id:         response.Id,
+		Subject:    response.Subject,
+		Version:    response.Version,
+		SchemaType: schemaTypeOrDefault(response.SchemaType),
+		Schema:     response.Schema,
+	}, nil
+}
+
+func (r *HTTPSchemaRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	request := registryRegisterRequest{
+		Schema: schema,
+	}
+	if schemaType != SchemaTypeAvro {
+		request.SchemaType = schemaType
+	}
+
+	var response registryRegisterResponse
+	if err := r.do(ctx, http.MethodPost, fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject)), request, &response); err != nil {
+		return 0, err
+	}
+
+	return response.Id, nil
+}
+
+func (r *HTTPSchemaRegistry) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", registryContentType)
+	if body != nil {
+		request.Header.Set("Content-Type", registryContentType)
+	}
+	if len(r.username) > 0 {
+		request.SetBasicAuth(r.username, r.password)
+	}
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("schema registry request failed: %w", err)
+	}
+
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrSchemaNotFound, path)
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		var registryErr registryErrorResponse
+		_ = json.NewDecoder(response.Body).Decode(&registryErr)
+		return fmt.Errorf("schema registry returned %d: %s", response.StatusCode, registryErr.Message)
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func schemaTypeOrDefault(schemaType string) string {
+	if len(schemaType) == 0 {
+		return SchemaTypeAvro
+	}
+
+	return schemaType
+}
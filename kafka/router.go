@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const HeaderType = "type"
+
+var ErrNoHandler = errors.New("no handler for message type")
+
+type Handler func(ctx context.Context, message Message) error
+
+type Middleware func(next Handler) Handler
+
+// BatchHandler обрабатывает пачку сообщений одного типа
+type BatchHandler func(ctx context.Context, messages []Message) error
+
+type messageTypeKey struct{}
+
+// Router выбирает обработчик по заголовку type, а для сообщений без него - по типу, привязанному к топику.
+// Цепочка middleware оборачивает каждый обработчик аналогично chi
+type Router struct {
+	mutex       *sync.RWMutex
+	middlewares []Middleware
+	handlers    map[string]Handler
+	batches     map[string]BatchHandler
+	topics      map[string]string
+	notFound    Handler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		mutex:    &sync.RWMutex{},
+		handlers: make(map[string]Handler),
+		batches:  make(map[string]BatchHandler),
+		topics:   make(map[string]string),
+		notFound: func(_ context.Context, message Message) error {
+			return Permanent(fmt.Errorf("%w: topic %s", ErrNoHandler, message.Topic))
+		},
+	}
+}
+
+func (r *Router) Use(middlewares ...Middleware) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+func (r *Router) Handle(messageType string, handler Handler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.handlers[messageType] = handler
+}
+
+// MapTopic задает тип для сообщений топика, пришедших без заголовка type
+func (r *Router) MapTopic(topic, messageType string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.topics[topic] = messageType
+}
+
+func (r *Router) NotFound(handler Handler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.notFound = handler
+}
+
+func (r *Router) Dispatch(ctx context.Context, message Message) error {
+	r.mutex.RLock()
+	messageType := r.messageType(message)
+	handler, ok := r.handlers[messageType]
+	if !ok {
+		handler = r.notFound
+	}
+	middlewares := r.middlewares
+	r.mutex.RUnlock()
+
+	return chain(handler, middlewares)(context.WithValue(ctx, messageTypeKey{}, messageType), message)
+}
+
+func chain(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+func (r *Router) messageType(message Message) string {
+	if messageType, ok := HeaderValue(message, HeaderType); ok && len(messageType) > 0 {
+		return messageType
+	}
+
+	return r.topics[message.Topic]
+}
+
+// Subscriber превращает роутер в подписчика консьюмера
+func (r *Router) Subscriber(ctx context.Context, log *zap.Logger) Subscriber {
+	return func(message Message, err error) error {
+		if err != nil {
+			log.Error("could not read message", zap.Error(err))
+			return nil
+		}
+
+		return r.Dispatch(ctx, message)
+	}
+}
+
+func MessageTypeFromContext(ctx context.Context) string {
+	messageType, _ := ctx.Value(messageTypeKey{}).(string)
+	return messageType
+}
+
+// HandleJSON регистрирует обработчик, получающий уже декодированное из JSON сообщение
+func HandleJSON[T any](r *Router, messageType string, handler func(ctx context.Context, message Message, payload T) error) {
+	HandleWith(r, messageType, NewJSONSerializer(nil), handler)
+}
+
+// HandleWith регистрирует обработчик, получающий сообщение, декодированное сериализатором
+func HandleWith[T any](r *Router, messageType string, serializer Serializer, handler func(ctx context.Context, message Message, payload T) error) {
+	r.Handle(messageType, func(ctx context.Context, message Message) error {
+		var payload T
+		if err := serializer.Deserialize(ctx, message.Topic, message.Value, decodeTarget(&payload)); err != nil {
+			return Permanent(fmt.Errorf("could not deserialize %s: %w", messageType, err))
+		}
+
+		return handler(ctx, message, payload)
+	})
+}
+
+// decodeTarget для T-указателя (например, proto.Message) создает значение и возвращает сам указатель
+func decodeTarget[T any](payload *T) any {
+	value := reflect.ValueOf(payload).Elem()
+	if value.Kind() != reflect.Pointer {
+		return payload
+	}
+
+	value.Set(reflect.New(value.Type().Elem()))
+
+	return *payload
+}
@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type batchGroup struct {
+	messageType string
+	handler     BatchHandler
+	messages    []Message
+}
+
+// HandleBatch регистрирует пакетный обработчик. Для пакетного подписчика он заменяет обработчик из Handle
+func (r *Router) HandleBatch(messageType string, handler BatchHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.batches[messageType] = handler
+}
+
+// DispatchBatch группирует пачку по типам. Для типов с пакетным обработчиком каждое сообщение проходит
+// цепочку middleware, внутри которой подготовленные сообщения передаются обработчику одной пачкой,
+// поэтому middleware видят результат и время записи всей пачки.
+// Остальные сообщения обрабатываются по одному через Dispatch
+func (r *Router) DispatchBatch(ctx context.Context, messages []Message) error {
+	r.mutex.RLock()
+	groups := make([]*batchGroup, 0, 1)
+	byType := make(map[string]*batchGroup)
+	for _, message := range messages {
+		messageType := r.messageType(message)
+
+		group, ok := byType[messageType]
+		if !ok {
+			group = &batchGroup{messageType: messageType, handler: r.batches[messageType]}
+			byType[messageType] = group
+			groups = append(groups, group)
+		}
+
+		group.messages = append(group.messages, message)
+	}
+	middlewares := r.middlewares
+	r.mutex.RUnlock()
+
+	for _, group := range groups {
+		if err := r.dispatchGroup(ctx, group, middlewares); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dispatchGroup проводит каждое сообщение группы через middleware в отдельной горутине.
+// Дойдя до конца цепочки, сообщение ждет, пока обработчик запишет всю пачку, и возвращает его результат.
+// Сообщения, отброшенные middleware без ошибки, в пачку не попадают, а ошибка любого сообщения отменяет пачку
+func (r *Router) dispatchGroup(ctx context.Context, group *batchGroup, middlewares []Middleware) error {
+	if group.handler == nil {
+		for _, message := range group.messages {
+			if err := r.Dispatch(ctx, message); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	typeCtx := context.WithValue(ctx, messageTypeKey{}, group.messageType)
+
+	size := len(group.messages)
+	prepared := make([]Message, size)
+	reached := make([]bool, size)
+	stopped := make([]error, size)
+	arrived := make([]sync.Once, size)
+	arrivals := &sync.WaitGroup{}
+	arrivals.Add(size)
+	handled := make(chan struct{})
+	var batchErr error
+
+	finished := &sync.WaitGroup{}
+	for i, message := range group.messages {
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+
+			handler := chain(func(_ context.Context, message Message) error {
+				arrived[i].Do(func() {
+					prepared[i] = message
+					reached[i] = true
+					arrivals.Done()
+				})
+
+				<-handled
+				return batchErr
+			}, middlewares)
+
+			err := handler(typeCtx, message)
+			arrived[i].Do(func() {
+				stopped[i] = err
+				arrivals.Done()
+			})
+		}()
+	}
+
+	arrivals.Wait()
+	func() {
+		defer close(handled)
+		defer func() {
+			if panicErr := recover(); panicErr != nil {
+				batchErr = fmt.Errorf("batch handler panicked: %v", panicErr)
+			}
+		}()
+
+		batch := make([]Message, 0, size)
+		for i := range prepared {
+			if stopped[i] != nil {
+				batchErr = stopped[i]
+				return
+			}
+
+			if reached[i] {
+				batch = append(batch, prepared[i])
+			}
+		}
+
+		if len(batch) > 0 {
+			batchErr = group.handler(typeCtx, batch)
+		}
+	}()
+	finished.Wait()
+
+	return batchErr
+}
+
+// BatchSubscriber превращает роутер в пакетного подписчика консьюмера
+func (r *Router) BatchSubscriber(ctx context.Context, log *zap.Logger) BatchSubscriber {
+	return func(messages []Message) error {
+		err := r.DispatchBatch(ctx, messages)
+		if err != nil {
+			log.Debug("could not handle batch", zap.Int("size", len(messages)), zap.Error(err))
+		}
+
+		return err
+	}
+}
+
+// HandleBatchJSON регистрирует пакетный обработчик, получающий уже декодированные из JSON сообщения
+func HandleBatchJSON[T any](r *Router, messageType string, handler func(ctx context.Context, messages []Message, payloads []T) error) {
+	HandleBatchWith(r, messageType, NewJSONSerializer(nil), handler)
+}
+
+// HandleBatchWith регистрирует пакетный обработчик, получающий сообщения, декодированные сериализатором.
+// Сообщение, которое не удалось декодировать, делает ошибку пачки неисправимой, чтобы консьюмер его изолировал
+func HandleBatchWith[T any](r *Router, messageType string, serializer Serializer, handler func(ctx context.Context, messages []Message, payloads []T) error) {
+	r.HandleBatch(messageType, func(ctx context.Context, messages []Message) error {
+		payloads := make([]T, len(messages))
+		for i, message := range messages {
+			if err := serializer.Deserialize(ctx, message.Topic, message.Value, decodeTarget(&payloads[i])); err != nil {
+				return Permanent(fmt.Errorf("could not deserialize %s at offset %d: %w", messageType, message.Offset, err))
+			}
+		}
+
+		return handler(ctx, messages, payloads)
+	})
+}
@@ -0,0 +1,305 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ReasonMalformedEnvelope  = "malformed_envelope"
+	ReasonTypeMismatch       = "type_mismatch"
+	ReasonUnknownVersion     = "unknown_version"
+	ReasonSchemaViolation    = "schema_violation"
+	ReasonUpcastFailed       = "upcast_failed"
+	ReasonUnsupportedMessage = "unsupported_message"
+	ReasonUnknownSchema      = "unknown_schema"
+)
+
+// RejectedError - неисправимая ошибка с машинно-читаемой причиной, попадающей в заголовки dead letter
+type RejectedError struct {
+	Reason string
+	Err    error
+}
+
+func (e RejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Err)
+}
+
+func (e RejectedError) Unwrap() error {
+	return e.Err
+}
+
+func Reject(reason string, err error) error {
+	return Permanent(RejectedError{Reason: reason, Err: err})
+}
+
+func RejectReason(err error) (string, bool) {
+	var rejected RejectedError
+	if errors.As(err, &rejected) {
+		return rejected.Reason, true
+	}
+
+	return "", false
+}
+
+// Upcaster переводит payload версии N в версию N+1
+type Upcaster func(payload json.RawMessage) (json.RawMessage, error)
+
+type schemaVersion struct {
+	schema   *jsonschema.Schema
+	upcaster Upcaster
+}
+
+// Schemas хранит зарегистрированные в коде версии схем сообщений
+type Schemas struct {
+	mutex    *sync.RWMutex
+	compiler *jsonschema.Compiler
+	versions map[string]map[int]schemaVersion
+	current  map[string]int
+	registry SchemaRegistry
+	avro     *AvroSerializer
+	protobuf *ProtobufSerializer
+	protos   map[string]proto.Message
+}
+
+func NewSchemas() *Schemas {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+
+	return &Schemas{
+		mutex:    &sync.RWMutex{},
+		compiler: compiler,
+		versions: make(map[string]map[int]schemaVersion),
+		current:  make(map[string]int),
+		protos:   make(map[string]proto.Message),
+	}
+}
+
+// UseRegistry включает прием сообщений в формате Confluent: JSON, Avro и Protobuf по схеме из реестра
+// приводятся к JSON и дальше проверяются так же, как обычные сообщения
+func (s *Schemas) UseRegistry(registry SchemaRegistry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.registry = registry
+	s.avro = NewAvroSerializer(registry)
+	s.protobuf = NewProtobufSerializer(registry)
+}
+
+// RegisterProto задает сообщение, в которое разбираются Protobuf-значения типа messageType. Разобранное сообщение
+// приводится к JSON с именами полей из .proto, поэтому они должны совпадать с полями JSON Schema
+func (s *Schemas) RegisterProto(messageType string, message proto.Message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.protos[messageType] = message
+}
+
+// Register добавляет JSON Schema версии version типа messageType.
+// upcaster переводит payload этой версии в следующую и не нужен для текущей версии
+func (s *Schemas) Register(messageType string, version int, document []byte, upcaster Upcaster) error {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(document))
+	if err != nil {
+		return fmt.Errorf("could not parse schema %s v%d: %w", messageType, version, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	url := fmt.Sprintf("https://user-service/schemas/%s/v%d.json", messageType, version)
+	if err = s.compiler.AddResource(url, doc); err != nil {
+		return fmt.Errorf("could not add schema %s v%d: %w", messageType, version, err)
+	}
+
+	schema, err := s.compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("could not compile schema %s v%d: %w", messageType, version, err)
+	}
+
+	if _, ok := s.versions[messageType]; !ok {
+		s.versions[messageType] = make(map[int]schemaVersion)
+	}
+
+	s.versions[messageType][version] = schemaVersion{
+		schema:   schema,
+		upcaster: upcaster,
+	}
+
+	if version > s.current[messageType] {
+		s.current[messageType] = version
+	}
+
+	return nil
+}
+
+// Decode разбирает конверт, проверяет payload по схеме его версии и доводит его до текущей версии.
+// Сообщения без конверта считаются payload первой версии типа messageType
+func (s *Schemas) Decode(messageType string, value []byte) (Envelope, error) {
+	envelope, err := parseEnvelope(messageType, value)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	if envelope.Type != messageType {
+		return Envelope{}, Reject(ReasonTypeMismatch, fmt.Errorf("envelope type %q does not match route %q", envelope.Type, messageType))
+	}
+
+	s.mutex.RLock()
+	versions, ok := s.versions[messageType]
+	current := s.current[messageType]
+	s.mutex.RUnlock()
+
+	if !ok {
+		return Envelope{}, Reject(ReasonUnsupportedMessage, fmt.Errorf("no schemas registered for %q", messageType))
+	}
+
+	for version := envelope.Version; ; version++ {
+		schemaVersion, ok := versions[version]
+		if !ok {
+			return Envelope{}, Reject(ReasonUnknownVersion, fmt.Errorf("%s v%d is not registered", messageType, version))
+		}
+
+		if err = validate(schemaVersion.schema, envelope.Payload); err != nil {
+			return Envelope{}, Reject(ReasonSchemaViolation, fmt.Errorf("%s v%d: %w", messageType, version, err))
+		}
+
+		if version >= current {
+			break
+		}
+
+		if schemaVersion.upcaster == nil {
+			return Envelope{}, Reject(ReasonUpcastFailed, fmt.Errorf("no upcaster from %s v%d", messageType, version))
+		}
+
+		envelope.Payload, err = schemaVersion.upcaster(envelope.Payload)
+		if err != nil {
+			return Envelope{}, Reject(ReasonUpcastFailed, fmt.Errorf("%s v%d: %w", messageType, version, err))
+		}
+
+		envelope.Version = version + 1
+	}
+
+	return envelope, nil
+}
+
+func parseEnvelope(messageType string, value []byte) (Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return Envelope{}, Reject(ReasonMalformedEnvelope, err)
+	}
+
+	if len(envelope.Type) == 0 && len(envelope.Payload) == 0 {
+		return Envelope{
+			Type:    messageType,
+			Version: 1,
+			Payload: value,
+		}, nil
+	}
+
+	if envelope.Version < 1 {
+		return Envelope{}, Reject(ReasonMalformedEnvelope, fmt.Errorf("envelope version %d is invalid", envelope.Version))
+	}
+
+	if len(envelope.Payload) == 0 {
+		return Envelope{}, Reject(ReasonMalformedEnvelope, errors.New("envelope payload is empty"))
+	}
+
+	return envelope, nil
+}
+
+func validate(schema *jsonschema.Schema, payload json.RawMessage) error {
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	return schema.Validate(instance)
+}
+
+// unwrapWire снимает заголовок Confluent и приводит значение типа messageType к JSON по схеме из реестра
+func (s *Schemas) unwrapWire(ctx context.Context, messageType string, value []byte) ([]byte, error) {
+	s.mutex.RLock()
+	registry, avroSerializer, protobufSerializer := s.registry, s.avro, s.protobuf
+	prototype, hasProto := s.protos[messageType]
+	s.mutex.RUnlock()
+
+	if registry == nil {
+		return nil, Reject(ReasonUnsupportedMessage, ErrSchemaRegistryRequired)
+	}
+
+	schemaId, payload, err := parseWireHeader(value)
+	if err != nil {
+		return nil, Reject(ReasonMalformedEnvelope, err)
+	}
+
+	registered, err := registry.SchemaById(ctx, schemaId)
+	if errors.Is(err, ErrSchemaNotFound) {
+		return nil, Reject(ReasonUnknownSchema, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get schema %d: %w", schemaId, err)
+	}
+
+	switch registered.SchemaType {
+	case SchemaTypeJSON:
+		return payload, nil
+	case SchemaTypeAvro:
+		var decoded any
+		if err = avroSerializer.Deserialize(ctx, "", value, &decoded); err != nil {
+			return nil, Reject(ReasonMalformedEnvelope, err)
+		}
+
+		return json.Marshal(decoded)
+	case SchemaTypeProtobuf:
+		if !hasProto {
+			return nil, Reject(ReasonUnsupportedMessage, fmt.Errorf("no protobuf message registered for %q", messageType))
+		}
+
+		message := prototype.ProtoReflect().New().Interface()
+		if err = protobufSerializer.Deserialize(ctx, "", value, message); err != nil {
+			return nil, Reject(ReasonMalformedEnvelope, err)
+		}
+
+		return protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	default:
+		return nil, Reject(ReasonUnsupportedMessage, fmt.Errorf("schema %d has unsupported type %s", schemaId, registered.SchemaType))
+	}
+}
+
+// Payload разбирает значение сообщения типа messageType так же, как Validate: снимает формат Confluent,
+// проверяет payload по схеме и приводит его к текущей версии
+func (s *Schemas) Payload(ctx context.Context, messageType string, value []byte) (Envelope, error) {
+	if IsWireFormat(value) {
+		var err error
+		if value, err = s.unwrapWire(ctx, messageType, value); err != nil {
+			return Envelope{}, err
+		}
+	}
+
+	return s.Decode(messageType, value)
+}
+
+// Validate проверяет сообщения по зарегистрированным схемам и передает дальше payload текущей версии.
+// Сообщения в формате Confluent сначала приводятся к JSON через реестр схем, без реестра они отклоняются
+func Validate(schemas *Schemas) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, message Message) error {
+			envelope, err := schemas.Payload(ctx, MessageTypeFromContext(ctx), message.Value)
+			if err != nil {
+				return err
+			}
+
+			message.Value = envelope.Payload
+
+			return next(context.WithValue(ctx, envelopeKey{}, envelope), message)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// MagicByte открывает сообщения в формате Confluent: 0x00, затем 4 байта id схемы (big endian)
+const MagicByte byte = 0x00
+
+const wireHeaderSize = 5
+
+var (
+	ErrNotWireFormat          = errors.New("message is not in confluent wire format")
+	ErrSchemaRegistryRequired = errors.New("confluent wire format requires a schema registry")
+)
+
+// Serializer кодирует значения сообщений. Схема выбирается по топику (subject "<topic>-value")
+type Serializer interface {
+	Serialize(ctx context.Context, topic string, value any) ([]byte, error)
+	Deserialize(ctx context.Context, topic string, data []byte, value any) error
+}
+
+func ValueSubject(topic string) string {
+	return topic + "-value"
+}
+
+func appendWireHeader(dst []byte, schemaId int) []byte {
+	dst = append(dst, MagicByte)
+	return binary.BigEndian.AppendUint32(dst, uint32(schemaId))
+}
+
+func IsWireFormat(data []byte) bool {
+	return len(data) >= wireHeaderSize && data[0] == MagicByte
+}
+
+func parseWireHeader(data []byte) (schemaId int, payload []byte, err error) {
+	if !IsWireFormat(data) {
+		return 0, nil, ErrNotWireFormat
+	}
+
+	return int(binary.BigEndian.Uint32(data[1:wireHeaderSize])), data[wireHeaderSize:], nil
+}
+
+// JSONSerializer пишет обычный JSON, а с реестром схем - JSON в формате Confluent
+type JSONSerializer struct {
+	registry SchemaRegistry
+}
+
+func NewJSONSerializer(registry SchemaRegistry) *JSONSerializer {
+	return &JSONSerializer{
+		registry: registry,
+	}
+}
+
+func (s *JSONSerializer) Serialize(ctx context.Context, topic string, value any) ([]byte, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.registry == nil {
+		return payload, nil
+	}
+
+	schema, err := s.registry.Latest(ctx, ValueSubject(topic))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(appendWireHeader(make([]byte, 0, wireHeaderSize+len(payload)), schema.Id), payload...), nil
+}
+
+// Deserialize без реестра не принимает сообщения в формате Confluent: их схему нечем проверить
+func (s *JSONSerializer) Deserialize(ctx context.Context, _ string, data []byte, value any) error {
+	if IsWireFormat(data) {
+		if s.registry == nil {
+			return ErrSchemaRegistryRequired
+		}
+
+		schemaId, payload, err := parseWireHeader(data)
+		if err != nil {
+			return err
+		}
+
+		if _, err = s.registry.SchemaById(ctx, schemaId); err != nil {
+			return err
+		}
+
+		data = payload
+	}
+
+	return json.Unmarshal(data, value)
+}
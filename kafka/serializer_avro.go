@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+// AvroSerializer кодирует значения в Avro по последней схеме subject, а декодирует по схеме из заголовка сообщения
+type AvroSerializer struct {
+	registry SchemaRegistry
+	mutex    *sync.RWMutex
+	parsed   map[int]avro.Schema
+}
+
+func NewAvroSerializer(registry SchemaRegistry) *AvroSerializer {
+	return &AvroSerializer{
+		registry: registry,
+		mutex:    &sync.RWMutex{},
+		parsed:   make(map[int]avro.Schema),
+	}
+}
+
+func (s *AvroSerializer) Serialize(ctx context.Context, topic string, value any) ([]byte, error) {
+	registered, err := s.registry.Latest(ctx, ValueSubject(topic))
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := s.schema(registered)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := avro.Marshal(schema, value)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal avro: %w", err)
+	}
+
+	return append(appendWireHeader(make([]byte, 0, wireHeaderSize+len(payload)), registered.Id), payload...), nil
+}
+
+func (s *AvroSerializer) Deserialize(ctx context.Context, _ string, data []byte, value any) error {
+	schemaId, payload, err := parseWireHeader(data)
+	if err != nil {
+		return err
+	}
+
+	registered, err := s.registry.SchemaById(ctx, schemaId)
+	if err != nil {
+		return err
+	}
+
+	schema, err := s.schema(registered)
+	if err != nil {
+		return err
+	}
+
+	if err = avro.Unmarshal(schema, payload, value); err != nil {
+		return fmt.Errorf("could not unmarshal avro: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AvroSerializer) schema(registered RegisteredSchema) (avro.Schema, error) {
+	s.mutex.RLock()
+	schema, ok := s.parsed[registered.Id]
+	s.mutex.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	if registered.SchemaType != SchemaTypeAvro {
+		return nil, fmt.Errorf("schema %d is %s, not avro", registered.Id, registered.SchemaType)
+	}
+
+	// Отдельный кэш на каждую схему, чтобы разные версии одного типа не конфликтовали по имени
+	schema, err := avro.ParseWithCache(registered.Schema, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("could not parse avro schema %d: %w", registered.Id, err)
+	}
+
+	s.mutex.Lock()
+	s.parsed[registered.Id] = schema
+	s.mutex.Unlock()
+
+	return schema, nil
+}
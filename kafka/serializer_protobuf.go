@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var ErrNotProtoMessage = errors.New("value is not a proto.Message")
+
+// ProtobufSerializer кодирует proto.Message в формате Confluent: после id схемы идут индексы сообщения в .proto файле
+type ProtobufSerializer struct {
+	registry SchemaRegistry
+}
+
+func NewProtobufSerializer(registry SchemaRegistry) *ProtobufSerializer {
+	return &ProtobufSerializer{
+		registry: registry,
+	}
+}
+
+func (s *ProtobufSerializer) Serialize(ctx context.Context, topic string, value any) ([]byte, error) {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+
+	registered, err := s.registry.Latest(ctx, ValueSubject(topic))
+	if err != nil {
+		return nil, err
+	}
+
+	if registered.SchemaType != SchemaTypeProtobuf {
+		return nil, fmt.Errorf("schema %d is %s, not protobuf", registered.Id, registered.SchemaType)
+	}
+
+	result := appendWireHeader(nil, registered.Id)
+	result = appendMessageIndexes(result, message.ProtoReflect().Descriptor())
+
+	return proto.MarshalOptions{}.MarshalAppend(result, message)
+}
+
+func (s *ProtobufSerializer) Deserialize(ctx context.Context, _ string, data []byte, value any) error {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+
+	schemaId, payload, err := parseWireHeader(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.registry.SchemaById(ctx, schemaId); err != nil {
+		return err
+	}
+
+	payload, err = skipMessageIndexes(payload)
+	if err != nil {
+		return err
+	}
+
+	return proto.Unmarshal(payload, message)
+}
+
+// appendMessageIndexes пишет путь до сообщения в файле. Путь [0] кодируется одним нулевым байтом
+func appendMessageIndexes(dst []byte, descriptor protoreflect.MessageDescriptor) []byte {
+	var indexes []int
+
+	var current protoreflect.Descriptor = descriptor
+	for {
+		indexes = append([]int{current.Index()}, indexes...)
+
+		parent, ok := current.Parent().(protoreflect.MessageDescriptor)
+		if !ok {
+			break
+		}
+
+		current = parent
+	}
+
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return binary.AppendVarint(dst, 0)
+	}
+
+	dst = binary.AppendVarint(dst, int64(len(indexes)))
+	for _, index := range indexes {
+		dst = binary.AppendVarint(dst, int64(index))
+	}
+
+	return dst
+}
+
+func skipMessageIndexes(data []byte) ([]byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, errors.New("invalid protobuf message indexes")
+	}
+
+	data = data[n:]
+	for i := int64(0); i < count; i++ {
+		_, n = binary.Varint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf message indexes")
+		}
+
+		data = data[n:]
+	}
+
+	return data, nil
+}
@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	testAvroSchema = `{
+		"type": "record",
+		"name": "Order",
+		"fields": [{"name": "Id", "type": "string"}, {"name": "Count", "type": "int"}]
+	}`
+	testProtoSchema = `syntax = "proto3";
+package google.protobuf;
+message Struct { map<string, Value> fields = 1; }`
+)
+
+func registerTestSchema(t *testing.T, registry SchemaRegistry, topic, schemaType, schema string) int {
+	t.Helper()
+
+	id, err := registry.Register(context.Background(), ValueSubject(topic), schemaType, schema)
+	if err != nil {
+		t.Fatalf("could not register %s schema: %v", schemaType, err)
+	}
+
+	return id
+}
+
+func TestAvroSerializerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+	registerTestSchema(t, registry, testTopic, SchemaTypeAvro, testAvroSchema)
+	serializer := NewAvroSerializer(registry)
+
+	data, err := serializer.Serialize(ctx, testTopic, map[string]any{"Id": "a", "Count": 2})
+	if err != nil {
+		t.Fatalf("could not serialize: %v", err)
+	}
+	if !IsWireFormat(data) {
+		t.Fatalf("serialized value has no wire header")
+	}
+
+	var decoded map[string]any
+	if err = serializer.Deserialize(ctx, testTopic, data, &decoded); err != nil {
+		t.Fatalf("could not deserialize: %v", err)
+	}
+
+	if decoded["Id"] != "a" || decoded["Count"] != 2 {
+		t.Fatalf("unexpected value: %v", decoded)
+	}
+}
+
+func TestProtobufSerializerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+	id := registerTestSchema(t, registry, testTopic, SchemaTypeProtobuf, testProtoSchema)
+	serializer := NewProtobufSerializer(registry)
+
+	order, err := structpb.NewStruct(map[string]any{"Id": "a", "Count": 2})
+	if err != nil {
+		t.Fatalf("could not build message: %v", err)
+	}
+
+	data, err := serializer.Serialize(ctx, testTopic, order)
+	if err != nil {
+		t.Fatalf("could not serialize: %v", err)
+	}
+
+	schemaId, payload, err := parseWireHeader(data)
+	if err != nil {
+		t.Fatalf("could not parse wire header: %v", err)
+	}
+	if schemaId != id {
+		t.Fatalf("got schema id %d, want %d", schemaId, id)
+	}
+	// Struct - первое сообщение в файле, его путь [0] кодируется одним нулевым байтом
+	if len(payload) == 0 || payload[0] != 0 {
+		t.Fatalf("got message indexes %x, want 00", payload[:min(len(payload), 1)])
+	}
+
+	decoded := &structpb.Struct{}
+	if err = serializer.Deserialize(ctx, testTopic, data, decoded); err != nil {
+		t.Fatalf("could not deserialize: %v", err)
+	}
+
+	if !proto.Equal(order, decoded) {
+		t.Fatalf("got %v, want %v", decoded, order)
+	}
+
+	if err = serializer.Deserialize(ctx, testTopic, data, &testOrder{}); !errors.Is(err, ErrNotProtoMessage) {
+		t.Fatalf("got error %v, want %v", err, ErrNotProtoMessage)
+	}
+}
+
+// TestSchemasPayloadWireFormat проверяет, что значения в формате Confluent проходят ту же проверку схемы,
+// что и обычные JSON-сообщения
+func TestSchemasPayloadWireFormat(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+
+	newSchemas := func(registry SchemaRegistry, proto bool) *Schemas {
+		schemas := NewSchemas()
+		err := schemas.Register(testMessageType, 1, []byte(`{
+			"type": "object",
+			"required": ["Id", "Count"],
+			"properties": {"Id": {"type": "string"}, "Count": {"type": "integer", "minimum": 1}}
+		}`), nil)
+		if err != nil {
+			t.Fatalf("could not register schema: %v", err)
+		}
+
+		if registry != nil {
+			schemas.UseRegistry(registry)
+		}
+		if proto {
+			schemas.RegisterProto(testMessageType, &structpb.Struct{})
+		}
+
+		return schemas
+	}
+
+	jsonId := registerTestSchema(t, registry, "json", SchemaTypeJSON, `{"type": "object"}`)
+	jsonValue := append(appendWireHeader(nil, jsonId), `{"Id":"a","Count":2}`...)
+	invalidJSONValue := append(appendWireHeader(nil, jsonId), `{"Id":"a","Count":0}`...)
+
+	registerTestSchema(t, registry, "avro", SchemaTypeAvro, testAvroSchema)
+	avroValue, err := NewAvroSerializer(registry).Serialize(ctx, "avro", map[string]any{"Id": "a", "Count": 2})
+	if err != nil {
+		t.Fatalf("could not serialize avro: %v", err)
+	}
+
+	registerTestSchema(t, registry, "protobuf", SchemaTypeProtobuf, testProtoSchema)
+	order, err := structpb.NewStruct(map[string]any{"Id": "a", "Count": 2})
+	if err != nil {
+		t.Fatalf("could not build message: %v", err)
+	}
+	protoValue, err := NewProtobufSerializer(registry).Serialize(ctx, "protobuf", order)
+	if err != nil {
+		t.Fatalf("could not serialize protobuf: %v", err)
+	}
+
+	unknownValue := append(appendWireHeader(nil, 100), `{}`...)
+
+	tests := []struct {
+		name    string
+		schemas *Schemas
+		value   []byte
+		reason  string
+	}{
+		{name: "json", schemas: newSchemas(registry, false), value: jsonValue},
+		{name: "json schema violation", schemas: newSchemas(registry, false), value: invalidJSONValue, reason: ReasonSchemaViolation},
+		{name: "avro", schemas: newSchemas(registry, false), value: avroValue},
+		{name: "protobuf", schemas: newSchemas(registry, true), value: protoValue},
+		{name: "protobuf without message", schemas: newSchemas(registry, false), value: protoValue, reason: ReasonUnsupportedMessage},
+		{name: "unknown schema", schemas: newSchemas(registry, false), value: unknownValue, reason: ReasonUnknownSchema},
+		{name: "no registry", schemas: newSchemas(nil, false), value: jsonValue, reason: ReasonUnsupportedMessage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envelope, err := test.schemas.Payload(ctx, testMessageType, test.value)
+			if len(test.reason) > 0 {
+				if reason, _ := RejectReason(err); reason != test.reason {
+					t.Fatalf("got error %v, want reason %q", err, test.reason)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var order testOrder
+			if err = json.Unmarshal(envelope.Payload, &order); err != nil {
+				t.Fatalf("could not unmarshal payload %s: %v", envelope.Payload, err)
+			}
+			if order.Id != "a" || order.Count != 2 {
+				t.Fatalf("unexpected payload: %s", envelope.Payload)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"user-service/config"
 	"user-service/os"
 
@@ -15,6 +16,8 @@ import (
 func main() {
 	configureDecimal()
 
+	flag.Parse()
+
 	mainCtx, cancelMainCtx := context.WithCancel(context.Background())
 	defer cancelMainCtx()
 
@@ -31,6 +34,20 @@ func main() {
 		return
 	}
 
+	if flag.Arg(0) == replayCommand {
+		if err = runReplay(mainCtx, log, settings, flag.Args()[1:]); err != nil {
+			log.Fatal("Failed to replay", zap.Error(err))
+		}
+		return
+	}
+
+	if flag.Arg(0) == backfillCommand {
+		if err = runBackfill(mainCtx, log, settings, flag.Args()[1:]); err != nil {
+			log.Fatal("Failed to backfill", zap.Error(err))
+		}
+		return
+	}
+
 	app := NewApp(mainCtx, log, settings)
 
 	if err = app.InitDatabases(); err != nil {
@@ -43,9 +60,16 @@ func main() {
 		return
 	}
 
-	app.InitServer()
+	if err = app.InitServer(); err != nil {
+		log.Error("Failed to init server", zap.Error(err))
+		return
+	}
 
-	app.Start()
+	if err = app.Start(); err != nil {
+		log.Error("Failed to start app", zap.Error(err))
+		app.Stop(mainCtx)
+		return
+	}
 
 	os.WaitTerminate(mainCtx, app.Stop)
 
@@ -1,20 +1,124 @@
 package pkg
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceName указывается как producer в конвертах событий сервиса
+const ServiceName = "user-service"
+
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+)
 
 type User struct {
-	Id      uuid.UUID `json:"Id"`
-	Email   string    `json:"Email"`
-	Name    string    `json:"Name"`
-	Surname string    `json:"Surname"`
+	Id        uuid.UUID  `json:"Id"`
+	Email     string     `json:"Email"`
+	Name      string     `json:"Name"`
+	Surname   string     `json:"Surname"`
+	Status    string     `json:"Status"`
+	Verified  bool       `json:"Verified"`
+	BirthDate *time.Time `json:"BirthDate"`
+}
+
+// UserVerification поля пользователя, которые проверяет политика бронирования. Меняются только через админский API,
+// пустой Status не меняется
+type UserVerification struct {
+	Status    string     `json:"Status"`
+	Verified  bool       `json:"Verified"`
+	BirthDate *time.Time `json:"BirthDate"`
 }
 
 type UserTicket struct {
 	UserId   uuid.UUID `json:"UserId"`
 	TicketId string    `json:"TicketId"`
+	EventId  string    `json:"EventId"`
 }
 
+const BookMessageType = "BookMessage"
+
+// BookMessage бронирование билета. EventId и MinAge появились во второй версии и могут быть пустыми
 type BookMessage struct {
 	UserId   uuid.UUID `json:"UserId"`
 	TicketId string    `json:"TicketId"`
+	EventId  string    `json:"EventId"`
+	MinAge   int       `json:"MinAge"`
+}
+
+// TicketTransferRequest получатель билета: ToUserId или ToEmail
+type TicketTransferRequest struct {
+	ToUserId uuid.UUID `json:"ToUserId"`
+	ToEmail  string    `json:"ToEmail"`
+}
+
+type TicketTransfer struct {
+	Id            uuid.UUID `json:"Id"`
+	TicketId      string    `json:"TicketId"`
+	FromUserId    uuid.UUID `json:"FromUserId"`
+	ToUserId      uuid.UUID `json:"ToUserId"`
+	InitiatedBy   string    `json:"InitiatedBy"`
+	TransferredAt time.Time `json:"TransferredAt"`
+}
+
+const TicketTransferredType = "TicketTransferred"
+
+// TicketTransferred событие о передаче билета, по которому сервис билетов перевыпускает билет
+type TicketTransferred struct {
+	TransferId    uuid.UUID `json:"TransferId"`
+	TicketId      string    `json:"TicketId"`
+	FromUserId    uuid.UUID `json:"FromUserId"`
+	ToUserId      uuid.UUID `json:"ToUserId"`
+	InitiatedBy   string    `json:"InitiatedBy"`
+	TransferredAt time.Time `json:"TransferredAt"`
+}
+
+// TicketConflict попытка привязать билет, которым уже владеет другой пользователь
+type TicketConflict struct {
+	Id          int64     `json:"Id"`
+	TicketId    string    `json:"TicketId"`
+	UserId      uuid.UUID `json:"UserId"`
+	OwnerUserId uuid.UUID `json:"OwnerUserId"`
+	MessageId   string    `json:"MessageId"`
+	Source      string    `json:"Source"`
+	DetectedAt  time.Time `json:"DetectedAt"`
+}
+
+const TicketOwnershipConflictType = "TicketOwnershipConflict"
+
+// TicketOwnershipConflict событие о бронировании, отправленном в карантин: билетом уже владеет OwnerUserId
+type TicketOwnershipConflict struct {
+	ConflictId  int64     `json:"ConflictId"`
+	TicketId    string    `json:"TicketId"`
+	UserId      uuid.UUID `json:"UserId"`
+	OwnerUserId uuid.UUID `json:"OwnerUserId"`
+	MessageId   string    `json:"MessageId"`
+	DetectedAt  time.Time `json:"DetectedAt"`
+}
+
+const BookingRejectedType = "BookingRejected"
+
+// BookingRejected событие об отклоненном политикой бронировании. Reason - код нарушенного правила
+type BookingRejected struct {
+	UserId     uuid.UUID `json:"UserId"`
+	TicketId   string    `json:"TicketId"`
+	EventId    string    `json:"EventId"`
+	MessageId  string    `json:"MessageId"`
+	Reason     string    `json:"Reason"`
+	RejectedAt time.Time `json:"RejectedAt"`
+}
+
+const (
+	UserCreatedType = "UserCreated"
+	UserUpdatedType = "UserUpdated"
+	UserDeletedType = "UserDeleted"
+	// UserSnapshotType снимок пользователя для backfill топика состояния, в топик событий не публикуется
+	UserSnapshotType = "UserSnapshot"
+)
+
+// UserDeleted payload события UserDeleted. UserCreated, UserUpdated и UserSnapshot содержат User целиком
+type UserDeleted struct {
+	Id uuid.UUID `json:"Id"`
 }
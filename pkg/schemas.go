@@ -0,0 +1,8 @@
+package pkg
+
+import "embed"
+
+// Schemas содержит JSON Schema сообщений, которые принимает сервис
+//
+//go:embed schemas/*.json
+var Schemas embed.FS
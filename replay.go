@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+	"user-service/config"
+	dbuser "user-service/db/user"
+	"user-service/kafka"
+	"user-service/pkg"
+	"user-service/service/user"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	replayCommand            = "replay"
+	defaultReplayIdleTimeout = 30 * time.Second
+)
+
+type replayOptions struct {
+	topic       string
+	partition   int
+	fromOffset  int64
+	toOffset    int64
+	from        time.Time
+	to          time.Time
+	key         string
+	userId      uuid.UUID
+	dryRun      bool
+	idleTimeout time.Duration
+}
+
+type replayStats struct {
+	read    int
+	skipped int
+	handled int
+	failed  int
+}
+
+// runReplay повторно прогоняет сообщения топика через цепочку обработчиков подписки.
+// Смещения группы не фиксируются, журнал обработанных сообщений не учитывается
+func runReplay(ctx context.Context, log *zap.Logger, settings config.Settings, args []string) error {
+	options, err := parseReplayOptions(args, settings.Kafka.Topics.UserTickets)
+	if err != nil {
+		return err
+	}
+
+	app := NewApp(ctx, log, settings)
+	if err = app.InitDatabases(); err != nil {
+		return fmt.Errorf("could not init databases: %w", err)
+	}
+
+	defer func() {
+		if closeErr := app.postgres.Close(); closeErr != nil {
+			log.Error("could not close postgres connection", zap.Error(closeErr))
+		}
+	}()
+
+	if err = app.initKafka(); err != nil {
+		return err
+	}
+
+	stats := &replayStats{}
+	repository := dbuser.NewReplayRepository(dbuser.NewRepository(app.postgres), options.dryRun)
+
+	service := user.NewService(repository, user.WithPolicy(newBookingPolicy(settings.Booking, repository)))
+
+	router, err := app.newRouter(service, options.filter(stats))
+	if err != nil {
+		return err
+	}
+
+	partitions, err := app.kafka.Offsets(ctx, options.topic)
+	if err != nil {
+		return fmt.Errorf("could not get offsets of %s: %w", options.topic, err)
+	}
+
+	for _, partition := range partitions {
+		if options.partition >= 0 && partition.Partition != options.partition {
+			continue
+		}
+
+		if err = app.replayPartition(ctx, router, options, partition, stats); err != nil {
+			return fmt.Errorf("could not replay partition %d: %w", partition.Partition, err)
+		}
+	}
+
+	for _, change := range repository.Changes() {
+		log.Info("replay change",
+			zap.String("action", change.Action),
+			zap.String("message_id", change.MessageId),
+			zap.String("user_id", change.UserId.String()),
+			zap.String("ticket_id", change.TicketId))
+	}
+
+	log.Info("replay finished",
+		zap.String("topic", options.topic),
+		zap.Bool("dry_run", options.dryRun),
+		zap.Int("read", stats.read),
+		zap.Int("skipped", stats.skipped),
+		zap.Int("handled", stats.handled),
+		zap.Int("failed", stats.failed),
+		zap.Int("changes", len(repository.Changes())))
+
+	if stats.failed > 0 {
+		return fmt.Errorf("could not replay %d messages", stats.failed)
+	}
+
+	return nil
+}
+
+func (a *App) replayPartition(ctx context.Context, router *kafka.Router, options replayOptions, partition kafka.PartitionOffsets, stats *replayStats) error {
+	consumer, err := a.kafka.Consumer(a.log, func() (context.Context, context.CancelFunc) {
+		return context.WithCancel(ctx)
+	}, kafka.WithTopic(options.topic), kafka.WithPartition(partition.Partition))
+	if err != nil {
+		return fmt.Errorf("could not create consumer: %w", err)
+	}
+
+	defer func() {
+		if closeErr := consumer.Close(context.WithoutCancel(ctx)); closeErr != nil {
+			a.log.Error("could not close replay consumer", zap.Error(closeErr))
+		}
+	}()
+
+	start := max(options.fromOffset, partition.First)
+	if !options.from.IsZero() {
+		start, err = consumer.SeekTimestamp(ctx, options.topic, partition.Partition, options.from)
+	} else {
+		err = consumer.SeekOffset(ctx, options.topic, partition.Partition, start)
+	}
+	if err != nil {
+		return fmt.Errorf("could not seek: %w", err)
+	}
+
+	end := partition.End
+	if options.toOffset >= 0 {
+		end = min(end, options.toOffset+1)
+	}
+
+	for offset := start; offset < end; {
+		message, err := a.consumeReplay(ctx, consumer, options.idleTimeout)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			// Хвост партиции может не прийти: например, смещения маркеров транзакций или удаленных записей
+			a.log.Warn("no messages within idle timeout, partition stopped",
+				zap.Int("partition", partition.Partition),
+				zap.Int64("offset", offset),
+				zap.Int64("end", end),
+				zap.Duration("idle_timeout", options.idleTimeout))
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read message: %w", err)
+		}
+
+		offset = message.Offset + 1
+		if !options.to.IsZero() && message.Time.After(options.to) {
+			break
+		}
+
+		stats.read++
+		if len(options.key) > 0 && string(message.Key) != options.key {
+			stats.skipped++
+			continue
+		}
+
+		skipped := stats.skipped
+		if err = router.Dispatch(ctx, message); err != nil {
+			stats.failed++
+			a.log.Warn("could not replay message",
+				zap.Int("partition", message.Partition),
+				zap.Int64("offset", message.Offset),
+				zap.Error(err))
+			continue
+		}
+
+		if stats.skipped == skipped {
+			stats.handled++
+		}
+	}
+
+	return nil
+}
+
+// consumeReplay ждет следующее сообщение не дольше idleTimeout
+func (a *App) consumeReplay(ctx context.Context, consumer kafka.Consumer, idleTimeout time.Duration) (kafka.Message, error) {
+	readCtx, cancel := context.WithTimeout(ctx, idleTimeout)
+	defer cancel()
+
+	return consumer.Consume(readCtx)
+}
+
+// filter пропускает сообщения других пользователей. Работает после Validate, когда payload уже извлечен из конверта
+func (o replayOptions) filter(stats *replayStats) kafka.Middleware {
+	return func(next kafka.Handler) kafka.Handler {
+		return func(ctx context.Context, message kafka.Message) error {
+			if o.userId != uuid.Nil {
+				var msg pkg.BookMessage
+				if err := json.Unmarshal(message.Value, &msg); err != nil || msg.UserId != o.userId {
+					stats.skipped++
+					return nil
+				}
+			}
+
+			return next(ctx, message)
+		}
+	}
+}
+
+func parseReplayOptions(args []string, defaultTopic string) (replayOptions, error) {
+	flags := flag.NewFlagSet(replayCommand, flag.ContinueOnError)
+
+	options := replayOptions{}
+	flags.StringVar(&options.topic, "topic", defaultTopic, "topic to replay")
+	flags.IntVar(&options.partition, "partition", -1, "partition to replay, -1 for all partitions")
+	flags.Int64Var(&options.fromOffset, "from-offset", 0, "first offset to replay")
+	flags.Int64Var(&options.toOffset, "to-offset", -1, "last offset to replay, -1 for the end of the partition")
+	from := flags.String("from", "", "replay messages written at or after this time (RFC 3339)")
+	to := flags.String("to", "", "replay messages written at or before this time (RFC 3339)")
+	flags.StringVar(&options.key, "key", "", "replay only messages with this key")
+	userId := flags.String("user-id", "", "replay only bookings of this user")
+	flags.BoolVar(&options.dryRun, "dry-run", false, "report changes without writing them")
+	flags.DurationVar(&options.idleTimeout, "idle-timeout", defaultReplayIdleTimeout, "stop a partition when no message arrives within this time")
+
+	if err := flags.Parse(args); err != nil {
+		return replayOptions{}, err
+	}
+
+	var err error
+	if len(*from) > 0 {
+		if options.from, err = time.Parse(time.RFC3339, *from); err != nil {
+			return replayOptions{}, fmt.Errorf("could not parse from: %w", err)
+		}
+	}
+	if len(*to) > 0 {
+		if options.to, err = time.Parse(time.RFC3339, *to); err != nil {
+			return replayOptions{}, fmt.Errorf("could not parse to: %w", err)
+		}
+	}
+	if len(*userId) > 0 {
+		if options.userId, err = uuid.Parse(*userId); err != nil {
+			return replayOptions{}, fmt.Errorf("could not parse user id: %w", err)
+		}
+	}
+
+	if !options.from.IsZero() && options.fromOffset > 0 {
+		return replayOptions{}, errors.New("from and from-offset are mutually exclusive")
+	}
+	if options.fromOffset < 0 {
+		return replayOptions{}, errors.New("from-offset must not be negative")
+	}
+	if options.idleTimeout <= 0 {
+		return replayOptions{}, errors.New("idle-timeout must be positive")
+	}
+
+	return options, nil
+}
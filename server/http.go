@@ -15,10 +15,13 @@ import (
 const (
 	listenTimeout   = 3 * time.Second
 	shutdownTimeout = 5 * time.Second
+
+	initialListenBackoff = 100 * time.Millisecond
+	bindAttempts         = 5
 )
 
 type Server interface {
-	Start()
+	Start() error
 	Stop()
 	UseHandler(http.Handler)
 }
@@ -30,12 +33,28 @@ type HTTPServer struct {
 	running *atomic.Bool
 }
 
-func NewHTTPServer(ctx context.Context, log *zap.Logger, addr string) *HTTPServer {
+func NewHTTPServer(ctx context.Context, log *zap.Logger, addr string, options ...HTTPServerOption) *HTTPServer {
+	opt := HTTPServerOptions{
+		ReadTimeout:       defaultReadTimeout,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+
+	for _, o := range options {
+		opt = o(opt)
+	}
+
 	return &HTTPServer{
 		ctx: ctx,
-		log: log,
+		log: log.With(zap.String("addr", addr)),
 		server: &http.Server{
-			Addr: addr,
+			Addr:              addr,
+			TLSConfig:         opt.TLSConfig,
+			ReadTimeout:       opt.ReadTimeout,
+			ReadHeaderTimeout: opt.ReadHeaderTimeout,
+			WriteTimeout:      opt.WriteTimeout,
+			IdleTimeout:       opt.IdleTimeout,
 			BaseContext: func(_ net.Listener) context.Context {
 				return ctx
 			},
@@ -44,29 +63,109 @@ func NewHTTPServer(ctx context.Context, log *zap.Logger, addr string) *HTTPServe
 	}
 }
 
-func (h *HTTPServer) Start() {
+// Start синхронно открывает сокет и возвращает ошибку, если его не удалось занять
+func (h *HTTPServer) Start() error {
 	if h.running.Load() {
-		return
+		return nil
+	}
+
+	listener, err := h.bind()
+	if err != nil {
+		return err
 	}
 
 	h.running.Store(true)
-	go h.listen()
+	go h.listen(listener)
+
+	return nil
 }
 
-func (h *HTTPServer) listen() {
+func (h *HTTPServer) bind() (net.Listener, error) {
+	backoff := initialListenBackoff
+
+	for attempt := 1; ; attempt++ {
+		listener, err := listen(h.server.Addr)
+		if err == nil {
+			return listener, nil
+		}
+
+		if attempt >= bindAttempts || isActivated(h.server.Addr) {
+			return nil, fmt.Errorf("could not bind %s: %w", h.server.Addr, err)
+		}
+
+		h.log.Warn(fmt.Sprintf("Failed to bind server. Retry in %s", backoff), zap.Error(err))
+
+		if err = h.sleep(backoff); err != nil {
+			return nil, err
+		}
+
+		backoff = nextListenBackoff(backoff)
+	}
+}
+
+func (h *HTTPServer) listen(listener net.Listener) {
 	h.log.Debug("Server is starting")
 
-	for h.running.Load() {
-		err := h.server.ListenAndServe()
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			h.log.Debug(fmt.Sprintf("Failed to start server. Retry in %s", listenTimeout), zap.Error(err))
-			continue
+	for listener != nil && h.running.Load() {
+		err := h.serve(listener)
+		if err == nil || errors.Is(err, http.ErrServerClosed) || !h.running.Load() {
+			break
+		}
+
+		if isActivated(h.server.Addr) {
+			h.log.Error("Server failed on activated socket", zap.Error(err))
+			break
 		}
+
+		h.log.Error("Server failed", zap.Error(err))
+		listener = h.rebind()
 	}
 
 	h.log.Debug("Server is stopped")
 }
 
+func (h *HTTPServer) rebind() net.Listener {
+	backoff := initialListenBackoff
+
+	for h.running.Load() {
+		h.log.Debug(fmt.Sprintf("Restarting server in %s", backoff))
+
+		if h.sleep(backoff) != nil {
+			return nil
+		}
+
+		listener, err := listen(h.server.Addr)
+		if err == nil {
+			return listener
+		}
+
+		h.log.Error("Failed to rebind server", zap.Error(err))
+		backoff = nextListenBackoff(backoff)
+	}
+
+	return nil
+}
+
+func (h *HTTPServer) serve(listener net.Listener) error {
+	if h.server.TLSConfig != nil {
+		return h.server.ServeTLS(listener, "", "")
+	}
+
+	return h.server.Serve(listener)
+}
+
+func (h *HTTPServer) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-h.ctx.Done():
+		return h.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func (h *HTTPServer) Stop() {
 	if !h.running.Load() {
 		return
@@ -85,3 +184,7 @@ func (h *HTTPServer) Stop() {
 func (h *HTTPServer) UseHandler(handler http.Handler) {
 	h.server.Handler = handler
 }
+
+func nextListenBackoff(current time.Duration) time.Duration {
+	return min(current*2, listenTimeout)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	unixPrefix    = "unix:"
+	systemdPrefix = "systemd"
+
+	listenFdsStart = 3
+)
+
+var (
+	ErrNotSocketActivated = errors.New("process was not started with socket activation")
+
+	activatedMutex = &sync.Mutex{}
+	activatedFds   = make(map[int]struct{})
+)
+
+// listen открывает слушающий сокет по адресу вида "host:port", "unix:/path/to.sock",
+// "systemd" (первый переданный сокет) или "systemd:name" (сокет с именем из LISTEN_FDNAMES)
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, unixPrefix):
+		return listenUnix(strings.TrimPrefix(strings.TrimPrefix(addr, unixPrefix), "//"))
+	case addr == systemdPrefix || strings.HasPrefix(addr, systemdPrefix+":"):
+		return listenActivated(strings.TrimPrefix(strings.TrimPrefix(addr, systemdPrefix), ":"))
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+func isActivated(addr string) bool {
+	return addr == systemdPrefix || strings.HasPrefix(addr, systemdPrefix+":")
+}
+
+// IsTCPAddress сообщает, что listen откроет по адресу TCP-сокет, а не unix-сокет или сокет от systemd
+func IsTCPAddress(addr string) bool {
+	return !strings.HasPrefix(addr, unixPrefix) && !isActivated(addr)
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove stale socket %s: %w", path, err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+func listenActivated(name string) (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, ErrNotSocketActivated
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, ErrNotSocketActivated
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	activatedMutex.Lock()
+	defer activatedMutex.Unlock()
+
+	for i := 0; i < count; i++ {
+		fdName := ""
+		if i < len(names) {
+			fdName = names[i]
+		}
+
+		if len(name) > 0 && fdName != name {
+			continue
+		}
+
+		fd := listenFdsStart + i
+		if _, ok := activatedFds[fd]; ok {
+			if len(name) > 0 {
+				return nil, fmt.Errorf("activated socket %q is already in use", name)
+			}
+
+			continue
+		}
+
+		file := os.NewFile(uintptr(fd), fdName)
+		listener, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not use activated socket %d: %w", fd, err)
+		}
+
+		activatedFds[fd] = struct{}{}
+		return listener, nil
+	}
+
+	return nil, fmt.Errorf("activated socket %q not found", name)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+const (
+	defaultReadTimeout       = 30 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+type HTTPServerOptions struct {
+	TLSConfig         *tls.Config
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+type HTTPServerOption func(o HTTPServerOptions) HTTPServerOptions
+
+func WithTLS(cfg *tls.Config) HTTPServerOption {
+	return func(o HTTPServerOptions) HTTPServerOptions {
+		o.TLSConfig = cfg
+		return o
+	}
+}
+
+func WithReadTimeout(timeout time.Duration) HTTPServerOption {
+	return func(o HTTPServerOptions) HTTPServerOptions {
+		if timeout > 0 {
+			o.ReadTimeout = timeout
+		}
+		return o
+	}
+}
+
+func WithReadHeaderTimeout(timeout time.Duration) HTTPServerOption {
+	return func(o HTTPServerOptions) HTTPServerOptions {
+		if timeout > 0 {
+			o.ReadHeaderTimeout = timeout
+		}
+		return o
+	}
+}
+
+func WithWriteTimeout(timeout time.Duration) HTTPServerOption {
+	return func(o HTTPServerOptions) HTTPServerOptions {
+		if timeout > 0 {
+			o.WriteTimeout = timeout
+		}
+		return o
+	}
+}
+
+func WithIdleTimeout(timeout time.Duration) HTTPServerOption {
+	return func(o HTTPServerOptions) HTTPServerOptions {
+		if timeout > 0 {
+			o.IdleTimeout = timeout
+		}
+		return o
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+	"user-service/config"
+
+	"go.uber.org/zap"
+)
+
+const defaultReloadInterval = time.Minute
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"none":               tls.NoClientCert,
+		"request":            tls.RequestClientCert,
+		"require":            tls.RequireAnyClientCert,
+		"verify_if_given":    tls.VerifyClientCertIfGiven,
+		"require_and_verify": tls.RequireAndVerifyClientCert,
+	}
+)
+
+// NewTLSConfig собирает конфигурацию TLS и запускает перечитывание сертификатов с диска до отмены ctx
+func NewTLSConfig(ctx context.Context, log *zap.Logger, settings config.TLS) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(settings.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherSuites, err := parseCipherSuites(settings.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth, err := parseClientAuth(settings.ClientAuth, len(settings.ClientCAFile) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	reloader := &certificateReloader{
+		log:      log,
+		certFile: settings.CertFile,
+		keyFile:  settings.KeyFile,
+		caFile:   settings.ClientCAFile,
+	}
+
+	if err = reloader.load(); err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		ClientAuth:     clientAuth,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	cfg := base.Clone()
+	cfg.GetConfigForClient = func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+		clientCfg := base.Clone()
+		clientCfg.ClientCAs = reloader.clientCAs.Load()
+		return clientCfg, nil
+	}
+
+	interval := settings.ReloadInterval.Std()
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	go reloader.watch(ctx, interval)
+
+	return cfg, nil
+}
+
+type certificateReloader struct {
+	log      *zap.Logger
+	certFile string
+	keyFile  string
+	caFile   string
+
+	certificate atomic.Pointer[tls.Certificate]
+	clientCAs   atomic.Pointer[x509.CertPool]
+	modTime     time.Time
+}
+
+func (c *certificateReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.certificate.Load(), nil
+}
+
+func (c *certificateReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := c.lastModified()
+			if err != nil {
+				c.log.Error("could not stat tls files", zap.Error(err))
+				continue
+			}
+
+			if !modTime.After(c.modTime) {
+				continue
+			}
+
+			if err = c.load(); err != nil {
+				c.log.Error("could not reload tls certificates", zap.Error(err))
+				continue
+			}
+
+			c.log.Info("tls certificates reloaded", zap.String("cert", c.certFile))
+		}
+	}
+}
+
+func (c *certificateReloader) load() error {
+	modTime, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load key pair: %w", err)
+	}
+
+	if len(c.caFile) > 0 {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return fmt.Errorf("could not read client ca bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("client ca bundle does not contain certificates")
+		}
+
+		c.clientCAs.Store(pool)
+	}
+
+	c.certificate.Store(&certificate)
+	c.modTime = modTime
+
+	return nil
+}
+
+func (c *certificateReloader) lastModified() (time.Time, error) {
+	var last time.Time
+
+	for _, file := range []string{c.certFile, c.keyFile, c.caFile} {
+		if len(file) == 0 {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+
+	return last, nil
+}
+
+func parseTLSVersion(raw string) (uint16, error) {
+	if len(raw) == 0 {
+		return tls.VersionTLS12, nil
+	}
+
+	version, ok := tlsVersions[raw]
+	if !ok {
+		return 0, fmt.Errorf("unknown tls version %q", raw)
+	}
+
+	return version, nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	result := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+
+		result = append(result, id)
+	}
+
+	return result, nil
+}
+
+func parseClientAuth(raw string, hasClientCA bool) (tls.ClientAuthType, error) {
+	if len(raw) == 0 {
+		if hasClientCA {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+
+		return tls.NoClientCert, nil
+	}
+
+	clientAuth, ok := clientAuthTypes[raw]
+	if !ok {
+		return 0, fmt.Errorf("unknown client auth type %q", raw)
+	}
+
+	if clientAuth >= tls.VerifyClientCertIfGiven && !hasClientCA {
+		return 0, fmt.Errorf("client auth %q requires client_ca_file", raw)
+	}
+
+	return clientAuth, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 	"user-service/kafka"
 	"user-service/pkg"
 
@@ -14,7 +15,13 @@ type User interface {
 	GetUsers(ctx context.Context, log *zap.Logger) ([]pkg.User, error)
 	AddUser(ctx context.Context, log *zap.Logger, user pkg.User) (uuid.UUID, error)
 	UpdateUser(ctx context.Context, log *zap.Logger, user pkg.User) error
+	UpdateUserVerification(ctx context.Context, log *zap.Logger, id uuid.UUID, verification pkg.UserVerification) error
 	DeleteUser(ctx context.Context, log *zap.Logger, id uuid.UUID) error
 	GetUserTicketsByUserId(ctx context.Context, log *zap.Logger, userId uuid.UUID) ([]pkg.UserTicket, error)
-	CreateSubscriberForBookMessage(ctx context.Context, log *zap.Logger) kafka.Subscriber
+	TransferUserTicket(ctx context.Context, log *zap.Logger, userId uuid.UUID, ticketId string, request pkg.TicketTransferRequest, initiatedBy string) (pkg.TicketTransfer, error)
+	GetTicketConflicts(ctx context.Context, log *zap.Logger, source string) ([]pkg.TicketConflict, error)
+	HandleBookMessage(ctx context.Context, log *zap.Logger, message kafka.Message, msg pkg.BookMessage) error
+	HandleBookMessages(ctx context.Context, log *zap.Logger, messages []kafka.Message, msgs []pkg.BookMessage) error
+	ExpirePendingUserTickets(ctx context.Context, log *zap.Logger, ttl time.Duration) error
+	CleanupProcessedMessages(ctx context.Context, log *zap.Logger, ttl time.Duration) error
 }
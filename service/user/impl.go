@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"time"
+	"user-service/db"
 	"user-service/db/user"
 	"user-service/kafka"
 	"user-service/pkg"
@@ -14,15 +17,36 @@ import (
 	"go.uber.org/zap"
 )
 
-var ErrCouldNotFindUser = errors.New("could not find user")
+const (
+	bookMessageConsumer = "book-message"
+	// bookMessageAttempts ограничивает повторы, когда пользователь появляется между вставкой билета и его откладыванием
+	bookMessageAttempts = 2
+)
+
+var (
+	ErrCouldNotFindUser   = errors.New("could not find user")
+	ErrUserAlreadyExists  = errors.New("user with this id or email already exists")
+	ErrInvalidUser        = errors.New("user data violates constraints")
+	ErrCouldNotFindTicket = errors.New("could not find ticket")
+	ErrTicketAlreadyOwned = errors.New("target user already has this ticket")
+	ErrInvalidTransfer    = errors.New("transfer target must be another user set by id or email")
+	ErrInvalidBooking     = errors.New("booking violates constraints")
+
+	ErrUnknownConflictSource = errors.New("unknown ticket conflict source")
+)
+
+var pendingMetrics = expvar.NewMap("pending_user_tickets")
 
 type Impl struct {
 	repository user.Repository
+	options    ServiceOptions
 }
 
-func NewService(repository user.Repository) *Impl {
+// NewService создает сервис пользователей. События о билетах репозиторий пишет в outbox вместе с изменениями
+func NewService(repository user.Repository, options ...ServiceOption) *Impl {
 	return &Impl{
 		repository: repository,
+		options:    newServiceOptions(options),
 	}
 }
 
@@ -30,11 +54,7 @@ func (s *Impl) GetUserById(ctx context.Context, log *zap.Logger, id uuid.UUID) (
 	dbUser, err := s.repository.GetUserById(ctx, id)
 	if err != nil {
 		log.Error("could not get user", zap.Error(err), zap.String("id", id.String()))
-		if errors.Is(err, sql.ErrNoRows) {
-			return pkg.User{}, ErrCouldNotFindUser
-		}
-
-		return pkg.User{}, err
+		return pkg.User{}, userError(err)
 	}
 
 	return MapUserToService(dbUser), nil
@@ -55,21 +75,54 @@ func (s *Impl) GetUsers(ctx context.Context, log *zap.Logger) ([]pkg.User, error
 	return result, nil
 }
 
-func (s *Impl) AddUser(ctx context.Context, log *zap.Logger, user pkg.User) (uuid.UUID, error) {
-	id, err := s.repository.AddUser(ctx, MapUserToDb(user))
+// AddUser создает пользователя и в той же транзакции привязывает к нему ожидающие билеты, прошедшие политику.
+// Ожидающие билеты, которыми уже владеет другой пользователь, попадают в карантин
+func (s *Impl) AddUser(ctx context.Context, log *zap.Logger, u pkg.User) (uuid.UUID, error) {
+	var (
+		id        uuid.UUID
+		attached  int64
+		conflicts []user.DbTicketConflict
+	)
+	err := s.repository.WithTx(ctx, func(ctx context.Context, repository user.Repository) error {
+		var err error
+		if id, err = repository.AddUser(ctx, MapUserToDb(u)); err != nil {
+			return err
+		}
+
+		attached, conflicts, err = s.attachPendingTickets(ctx, log, repository, id)
+
+		return err
+	})
 	if err != nil {
 		log.Error("could not add user", zap.Error(err))
-		return uuid.Nil, err
+		return uuid.Nil, userError(err)
+	}
+
+	if attached > 0 {
+		pendingMetrics.Add("attached", attached)
+		log.Info("attached pending user tickets", zap.String("user_id", id.String()), zap.Int64("count", attached))
 	}
 
+	logTicketConflicts(log, conflicts)
+
 	return id, nil
 }
 
 func (s *Impl) UpdateUser(ctx context.Context, log *zap.Logger, user pkg.User) error {
 	err := s.repository.UpdateUser(ctx, MapUserToDb(user))
 	if err != nil {
-		log.Error("could not update user", zap.Error(err))
-		return err
+		log.Error("could not update user", zap.Error(err), zap.String("id", user.Id.String()))
+		return userError(err)
+	}
+
+	return nil
+}
+
+func (s *Impl) UpdateUserVerification(ctx context.Context, log *zap.Logger, id uuid.UUID, verification pkg.UserVerification) error {
+	err := s.repository.UpdateUserVerification(ctx, MapUserVerificationToDb(id, verification))
+	if err != nil {
+		log.Error("could not update user verification", zap.Error(err), zap.String("id", id.String()))
+		return userError(err)
 	}
 
 	return nil
@@ -79,12 +132,41 @@ func (s *Impl) DeleteUser(ctx context.Context, log *zap.Logger, id uuid.UUID) er
 	err := s.repository.DeleteUser(ctx, id)
 	if err != nil {
 		log.Error("could not delete user", zap.Error(err), zap.String("id", id.String()))
-		return err
+		return userError(err)
 	}
 
 	return nil
 }
 
+// userError переводит ошибки репозитория и коды ошибок postgres в ошибки сервиса
+func userError(err error) error {
+	switch {
+	case errors.Is(err, user.ErrNotFound), db.IsForeignKeyViolation(err):
+		return ErrCouldNotFindUser
+	case errors.Is(err, user.ErrConflict), db.IsUniqueViolation(err):
+		return ErrUserAlreadyExists
+	case db.IsCheckViolation(err):
+		return ErrInvalidUser
+	}
+
+	return err
+}
+
+// bookingError переводит ошибки записи бронирования в ошибки сервиса. Бронирование, нарушающее другие ограничения
+// схемы, помечается kafka.Permanent: повторная обработка его не исправит
+func bookingError(err error) error {
+	switch {
+	case errors.Is(err, user.ErrNotFound), db.IsForeignKeyViolation(err):
+		return fmt.Errorf("%w: %w", ErrCouldNotFindUser, err)
+	case errors.Is(err, user.ErrConflict):
+		return fmt.Errorf("%w: %w", ErrUserAlreadyExists, err)
+	case db.IsIntegrityViolation(err):
+		return kafka.Permanent(fmt.Errorf("%w: %w", ErrInvalidBooking, err))
+	}
+
+	return err
+}
+
 func (s *Impl) GetUserTicketsByUserId(ctx context.Context, log *zap.Logger, userId uuid.UUID) ([]pkg.UserTicket, error) {
 	dbUserTickets, err := s.repository.GetUserTicketsByUserId(ctx, userId)
 	if err != nil {
@@ -100,29 +182,479 @@ func (s *Impl) GetUserTicketsByUserId(ctx context.Context, log *zap.Logger, user
 	return result, nil
 }
 
-func (s *Impl) CreateSubscriberForBookMessage(ctx context.Context, log *zap.Logger) kafka.Subscriber {
-	return func(message kafka.Message, err error) {
+// TransferUserTicket передает билет пользователя userId получателю из request. Поиск получателя, передача
+// и запись TicketTransferred в outbox выполняются в одной транзакции
+func (s *Impl) TransferUserTicket(ctx context.Context, log *zap.Logger, userId uuid.UUID, ticketId string, request pkg.TicketTransferRequest, initiatedBy string) (pkg.TicketTransfer, error) {
+	var dbTransfer user.DbTicketTransfer
+	err := s.repository.WithTx(ctx, func(ctx context.Context, repository user.Repository) error {
+		toUserId, err := s.transferTarget(ctx, log, repository, request)
 		if err != nil {
-			log.Error("could not create read message", zap.Error(err))
-			return
+			return err
+		}
+		if toUserId == userId {
+			return ErrInvalidTransfer
 		}
 
-		var msg pkg.BookMessage
-		err = json.Unmarshal(message.Value, &msg)
-		if err != nil {
-			log.Error("could not unmarshal message", zap.Error(err))
-			return
+		dbTransfer, err = repository.TransferUserTicket(ctx, user.DbTicketTransfer{
+			TicketId:    ticketId,
+			FromUserId:  userId,
+			ToUserId:    toUserId,
+			InitiatedBy: initiatedBy,
+		})
+
+		return err
+	}, db.WithIsolation(sql.LevelRepeatableRead))
+	if err != nil {
+		if errors.Is(err, ErrInvalidTransfer) || errors.Is(err, ErrCouldNotFindUser) {
+			return pkg.TicketTransfer{}, err
+		}
+
+		log.Error("could not transfer user ticket", zap.Error(err),
+			zap.String("user_id", userId.String()), zap.String("ticket_id", ticketId))
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return pkg.TicketTransfer{}, ErrCouldNotFindTicket
+		case db.IsForeignKeyViolation(err):
+			return pkg.TicketTransfer{}, ErrCouldNotFindUser
+		case db.IsUniqueViolation(err):
+			return pkg.TicketTransfer{}, ErrTicketAlreadyOwned
+		}
+
+		return pkg.TicketTransfer{}, err
+	}
+
+	return MapTicketTransferToService(dbTransfer), nil
+}
+
+func (s *Impl) transferTarget(ctx context.Context, log *zap.Logger, repository user.Repository, request pkg.TicketTransferRequest) (uuid.UUID, error) {
+	if (request.ToUserId == uuid.Nil) == (len(request.ToEmail) == 0) {
+		return uuid.Nil, ErrInvalidTransfer
+	}
+	if request.ToUserId != uuid.Nil {
+		return request.ToUserId, nil
+	}
+
+	dbUser, err := repository.GetUserByEmail(ctx, request.ToEmail)
+	if err != nil {
+		log.Error("could not get user by email", zap.Error(err))
+		if errors.Is(err, user.ErrNotFound) {
+			return uuid.Nil, ErrCouldNotFindUser
+		}
+
+		return uuid.Nil, err
+	}
+
+	return dbUser.Id, nil
+}
+
+func (s *Impl) HandleBookMessage(ctx context.Context, log *zap.Logger, message kafka.Message, msg pkg.BookMessage) error {
+	for attempt := 1; ; attempt++ {
+		err := s.handleBookMessage(ctx, log, message, msg)
+		if !errors.Is(err, ErrUserAlreadyExists) {
+			return err
+		}
+		if attempt == bookMessageAttempts {
+			log.Error("user keeps changing while ticket is parked", zap.String("message_id", kafka.MessageId(message)))
+			return fmt.Errorf("could not add ticket of user %s: %w", msg.UserId, err)
+		}
+
+		log.Debug("user appeared while ticket was parked, handling message again", zap.String("message_id", kafka.MessageId(message)))
+	}
+}
+
+// handleBookMessage возвращает ErrUserAlreadyExists, если пользователь появился, пока билет откладывался
+func (s *Impl) handleBookMessage(ctx context.Context, log *zap.Logger, message kafka.Message, msg pkg.BookMessage) error {
+	messageId := kafka.MessageId(message)
+
+	var (
+		accepted  []int
+		processed bool
+		conflicts []user.DbTicketConflict
+	)
+	// Политика проверяется в транзакции вставки: пользователь заблокирован до ее конца,
+	// поэтому параллельные бронирования одного пользователя не обходят MaxTicketsPerEvent
+	err := s.repository.WithTx(ctx, func(ctx context.Context, repository user.Repository) error {
+		var err error
+		accepted, err = s.applyPolicy(ctx, log, repository, []kafka.Message{message}, []pkg.BookMessage{msg})
+		if err != nil || len(accepted) == 0 {
+			return err
 		}
 
-		err = s.repository.AddUserTicket(ctx, user.DbUserTicket{
+		processed, conflicts, err = repository.AddUserTicketFromMessage(ctx, user.DbProcessedMessage{
+			Consumer:  bookMessageConsumer,
+			MessageId: messageId,
+		}, user.DbUserTicket{
 			UserId:   msg.UserId,
 			TicketId: msg.TicketId,
+			EventId:  msg.EventId,
 		})
+
+		return bookingError(err)
+	})
+	if errors.Is(err, ErrCouldNotFindUser) {
+		return s.addPendingUserTicket(ctx, log, messageId, msg)
+	}
+	if err != nil {
+		log.Error("could not add user ticket", zap.Error(err))
+		return err
+	}
+	if len(accepted) == 0 {
+		return nil
+	}
+
+	if !processed {
+		log.Debug("skipped duplicate book message", zap.String("message_id", messageId))
+		return nil
+	}
+
+	logTicketConflicts(log, conflicts)
+
+	log.Debug(fmt.Sprintf("consumed book message: %v", msg))
+
+	return nil
+}
+
+// HandleBookMessages добавляет билеты пачки сообщений одной вставкой, messages[i] соответствует msgs[i]
+func (s *Impl) HandleBookMessages(ctx context.Context, log *zap.Logger, messages []kafka.Message, msgs []pkg.BookMessage) error {
+	var (
+		added     int64
+		conflicts []user.DbTicketConflict
+	)
+	// политика проверяется в транзакции вставки, как в handleBookMessage
+	err := s.repository.WithTx(ctx, func(ctx context.Context, repository user.Repository) error {
+		added, conflicts = 0, nil
+
+		accepted, err := s.applyPolicy(ctx, log, repository, messages, msgs)
+		if err != nil || len(accepted) == 0 {
+			return err
+		}
+
+		processedMessages := make([]user.DbProcessedMessage, 0, len(accepted))
+		userTickets := make([]user.DbUserTicket, 0, len(accepted))
+		for _, i := range accepted {
+			processedMessages = append(processedMessages, user.DbProcessedMessage{
+				Consumer:  bookMessageConsumer,
+				MessageId: kafka.MessageId(messages[i]),
+			})
+			userTickets = append(userTickets, user.DbUserTicket{
+				UserId:   msgs[i].UserId,
+				TicketId: msgs[i].TicketId,
+				EventId:  msgs[i].EventId,
+			})
+		}
+
+		added, conflicts, err = repository.AddUserTickets(ctx, processedMessages, userTickets)
+
+		return bookingError(err)
+	})
+	if errors.Is(err, ErrCouldNotFindUser) {
+		// транзакция откатилась вместе с отказами, поэтому заново обрабатывается вся пачка
+		log.Debug("batch has tickets of unknown users, handling messages one by one", zap.Int("size", len(messages)))
+		for i, message := range messages {
+			if err = s.HandleBookMessage(ctx, log, message, msgs[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+	if err != nil {
+		log.Error("could not add user tickets", zap.Int("size", len(messages)), zap.Error(err))
+		return err
+	}
+
+	logTicketConflicts(log, conflicts)
+
+	log.Debug(fmt.Sprintf("consumed %d book messages, added %d tickets", len(messages), added))
+
+	return nil
+}
+
+// applyPolicy проверяет бронирования правилами политики и возвращает индексы принятых, messages[i] соответствует msgs[i].
+// Сообщения, которые уже есть в журнале, не проверяются и не принимаются: их результат уже записан.
+// Бронирования неизвестных пользователей принимаются: их билеты уходят в ожидание и проверяются при появлении пользователя.
+// Найденные пользователи блокируются до конца транзакции из ctx
+func (s *Impl) applyPolicy(ctx context.Context, log *zap.Logger, repository user.Repository, messages []kafka.Message, msgs []pkg.BookMessage) ([]int, error) {
+	accepted := make([]int, 0, len(msgs))
+	if s.options.Policy.Empty() {
+		for i := range msgs {
+			accepted = append(accepted, i)
+		}
+
+		return accepted, nil
+	}
+
+	messageIds := make([]string, 0, len(messages))
+	for _, message := range messages {
+		messageIds = append(messageIds, kafka.MessageId(message))
+	}
+
+	processedIds, err := repository.GetProcessedMessageIds(ctx, bookMessageConsumer, messageIds)
+	if err != nil {
+		log.Error("could not get processed messages", zap.Error(err))
+		return nil, err
+	}
+
+	processed := make(map[string]struct{}, len(processedIds))
+	for _, messageId := range processedIds {
+		processed[messageId] = struct{}{}
+	}
+
+	ids := make([]uuid.UUID, 0, len(msgs))
+	for _, msg := range msgs {
+		ids = append(ids, msg.UserId)
+	}
+
+	dbUsers, err := repository.LockUsersByIds(ctx, ids)
+	if err != nil {
+		log.Error("could not lock users", zap.Error(err))
+		return nil, err
+	}
+
+	users := make(map[uuid.UUID]pkg.User, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		users[dbUser.Id] = MapUserToService(dbUser)
+	}
+
+	acceptedMsgs := make([]pkg.BookMessage, 0, len(msgs))
+	for i, msg := range msgs {
+		messageId := messageIds[i]
+		if _, ok := processed[messageId]; ok {
+			log.Debug("skipped duplicate book message", zap.String("message_id", messageId))
+			continue
+		}
+
+		u, ok := users[msg.UserId]
+		if !ok {
+			accepted = append(accepted, i)
+			continue
+		}
+
+		reason, err := s.options.Policy.Evaluate(ctx, Booking{User: u, Message: msg, Accepted: acceptedMsgs})
 		if err != nil {
-			log.Error("could not add user ticket", zap.Error(err))
-			return
+			log.Error("could not evaluate booking policy", zap.Error(err))
+			return nil, err
+		}
+
+		if len(reason) == 0 {
+			accepted = append(accepted, i)
+			acceptedMsgs = append(acceptedMsgs, msg)
+			continue
+		}
+
+		if err = s.rejectBooking(ctx, log, repository, messageId, msg, reason); err != nil {
+			return nil, err
+		}
+	}
+
+	return accepted, nil
+}
+
+// rejectBooking записывает сообщение в журнал и в той же транзакции пишет BookingRejected в outbox.
+// Если сообщение уже есть в журнале, отказ не повторяется
+func (s *Impl) rejectBooking(ctx context.Context, log *zap.Logger, repository user.Repository, messageId string, msg pkg.BookMessage, reason string) error {
+	logBookingRejected(log, messageId, msg, reason)
+
+	err := repository.WithTx(ctx, func(ctx context.Context, repository user.Repository) error {
+		processed, err := repository.AddProcessedMessage(ctx, user.DbProcessedMessage{
+			Consumer:  bookMessageConsumer,
+			MessageId: messageId,
+		})
+		if err != nil || !processed {
+			return err
+		}
+
+		return repository.AddBookingRejected(ctx, s.bookingRejection(messageId, msg, reason))
+	})
+	if err != nil {
+		log.Error("could not reject booking", zap.Error(err), zap.String("message_id", messageId))
+		return err
+	}
+
+	return nil
+}
+
+// attachPendingTickets забирает ожидающие билеты пользователя userId, проверяет их политикой и привязывает принятые.
+// Сообщения этих билетов уже в журнале, поэтому об отклоненных в outbox сразу пишется BookingRejected
+func (s *Impl) attachPendingTickets(ctx context.Context, log *zap.Logger, repository user.Repository, userId uuid.UUID) (int64, []user.DbTicketConflict, error) {
+	pending, err := repository.TakePendingUserTickets(ctx, userId)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(pending) == 0 || s.options.Policy.Empty() {
+		return repository.AttachUserTickets(ctx, pending)
+	}
+
+	dbUser, err := repository.GetUserById(ctx, userId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	u := MapUserToService(dbUser)
+	accepted := make([]user.DbPendingUserTicket, 0, len(pending))
+	acceptedMsgs := make([]pkg.BookMessage, 0, len(pending))
+	for _, ticket := range pending {
+		msg := pkg.BookMessage{
+			UserId:   ticket.UserId,
+			TicketId: ticket.TicketId,
+			EventId:  ticket.EventId,
+			MinAge:   ticket.MinAge,
+		}
+
+		reason, err := s.options.Policy.Evaluate(ctx, Booking{User: u, Message: msg, Accepted: acceptedMsgs})
+		if err != nil {
+			return 0, nil, fmt.Errorf("could not evaluate booking policy: %w", err)
+		}
+
+		if len(reason) == 0 {
+			accepted = append(accepted, ticket)
+			acceptedMsgs = append(acceptedMsgs, msg)
+			continue
+		}
+
+		logBookingRejected(log, ticket.MessageId, msg, reason)
+		if err = repository.AddBookingRejected(ctx, s.bookingRejection(ticket.MessageId, msg, reason)); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return repository.AttachUserTickets(ctx, accepted)
+}
+
+func (s *Impl) bookingRejection(messageId string, msg pkg.BookMessage, reason string) user.DbBookingRejection {
+	return user.DbBookingRejection{
+		UserId:     msg.UserId,
+		TicketId:   msg.TicketId,
+		EventId:    msg.EventId,
+		MessageId:  messageId,
+		Reason:     reason,
+		RejectedAt: s.options.Now().UTC(),
+	}
+}
+
+func logBookingRejected(log *zap.Logger, messageId string, msg pkg.BookMessage, reason string) {
+	log.Info("booking rejected by policy",
+		zap.String("message_id", messageId),
+		zap.String("user_id", msg.UserId.String()),
+		zap.String("ticket_id", msg.TicketId),
+		zap.String("event_id", msg.EventId),
+		zap.String("reason", reason))
+}
+
+// addPendingUserTicket откладывает билет до появления пользователя. Если пользователь уже появился,
+// возвращает ErrUserAlreadyExists: бронирование нужно проверить политикой заново
+func (s *Impl) addPendingUserTicket(ctx context.Context, log *zap.Logger, messageId string, msg pkg.BookMessage) error {
+	pending, err := s.repository.AddPendingUserTicket(ctx, user.DbProcessedMessage{
+		Consumer:  bookMessageConsumer,
+		MessageId: messageId,
+	}, user.DbPendingUserTicket{
+		UserId:   msg.UserId,
+		TicketId: msg.TicketId,
+		EventId:  msg.EventId,
+		MinAge:   msg.MinAge,
+	})
+	err = bookingError(err)
+	if errors.Is(err, ErrUserAlreadyExists) {
+		return err
+	}
+	if err != nil {
+		log.Error("could not add pending user ticket", zap.Error(err))
+		return err
+	}
+
+	if pending {
+		pendingMetrics.Add("added", 1)
+		log.Warn("user not found, ticket is pending",
+			zap.String("message_id", messageId),
+			zap.String("user_id", msg.UserId.String()),
+			zap.String("ticket_id", msg.TicketId))
+	}
+
+	return nil
+}
+
+// logTicketConflicts сообщает о бронированиях, попавших в карантин из-за другого владельца билета.
+// TicketOwnershipConflict репозиторий уже записал в outbox в той же транзакции
+func logTicketConflicts(log *zap.Logger, conflicts []user.DbTicketConflict) {
+	for _, conflict := range conflicts {
+		log.Warn("ticket already has another owner, booking is quarantined",
+			zap.Int64("conflict_id", conflict.Id),
+			zap.String("message_id", conflict.MessageId),
+			zap.String("ticket_id", conflict.TicketId),
+			zap.String("user_id", conflict.UserId.String()),
+			zap.String("owner_user_id", conflict.OwnerUserId.String()))
+	}
+}
+
+// GetTicketConflicts возвращает конфликты владения билетами из источника source: migration или booking, пустой - все
+func (s *Impl) GetTicketConflicts(ctx context.Context, log *zap.Logger, source string) ([]pkg.TicketConflict, error) {
+	switch source {
+	case "", user.TicketConflictMigration, user.TicketConflictBooking:
+	default:
+		return nil, ErrUnknownConflictSource
+	}
+
+	dbConflicts, err := s.repository.GetTicketConflicts(ctx, source)
+	if err != nil {
+		log.Error("could not get ticket conflicts", zap.Error(err))
+		return nil, err
+	}
+
+	result := make([]pkg.TicketConflict, 0, len(dbConflicts))
+	for _, dbConflict := range dbConflicts {
+		result = append(result, MapTicketConflictToService(dbConflict))
+	}
+
+	return result, nil
+}
+
+// ExpirePendingUserTickets удаляет билеты, которые ждали пользователя дольше ttl. Каждый такой билет - потерянное бронирование
+func (s *Impl) ExpirePendingUserTickets(ctx context.Context, log *zap.Logger, ttl time.Duration) error {
+	expired, err := s.repository.DeletePendingUserTickets(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		log.Error("could not delete pending user tickets", zap.Error(err))
+		return err
+	}
+
+	for _, ticket := range expired {
+		pendingMetrics.Add("expired", 1)
+		log.Error("pending user ticket expired, booking is lost",
+			zap.String("message_id", ticket.MessageId),
+			zap.String("user_id", ticket.UserId.String()),
+			zap.String("ticket_id", ticket.TicketId),
+			zap.Time("created_at", ticket.CreatedAt))
+	}
+
+	return nil
+}
+
+func (s *Impl) CleanupProcessedMessages(ctx context.Context, log *zap.Logger, ttl time.Duration) error {
+	deleted, err := s.repository.DeleteProcessedMessages(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		log.Error("could not delete processed messages", zap.Error(err))
+		return err
+	}
+
+	log.Debug(fmt.Sprintf("deleted %d processed messages", deleted))
+
+	return nil
+}
+
+// NewBookMessageShardKey шардирует сообщения о бронировании по пользователю, чтобы сохранить порядок его бронирований.
+// Сообщение разбирается через schemas так же, как в обработчике, поэтому UserId находится и внутри конверта.
+// Сообщения, которые не удалось разобрать, шардируются по ключу
+func NewBookMessageShardKey(schemas *kafka.Schemas) func(kafka.Message) []byte {
+	return func(message kafka.Message) []byte {
+		envelope, err := schemas.Payload(context.Background(), pkg.BookMessageType, message.Value)
+		if err != nil {
+			return kafka.MessageKey(message)
+		}
+
+		var msg pkg.BookMessage
+		if err = json.Unmarshal(envelope.Payload, &msg); err != nil || msg.UserId == uuid.Nil {
+			return kafka.MessageKey(message)
 		}
 
-		log.Debug(fmt.Sprintf("consumed book message: %v", msg))
+		return msg.UserId[:]
 	}
 }
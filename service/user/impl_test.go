@@ -0,0 +1,90 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"user-service/db"
+	"user-service/db/user"
+	"user-service/pkg"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// flappingRepository каждый раз не находит пользователя при вставке билета и находит его при откладывании
+type flappingRepository struct {
+	*user.MemoryRepository
+
+	inserts int
+}
+
+func (r *flappingRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repository user.Repository) error, options ...db.TxOption) error {
+	return r.MemoryRepository.WithTx(ctx, func(ctx context.Context, _ user.Repository) error {
+		return fn(ctx, r)
+	}, options...)
+}
+
+func (r *flappingRepository) AddUserTicketFromMessage(context.Context, user.DbProcessedMessage, user.DbUserTicket) (bool, []user.DbTicketConflict, error) {
+	r.inserts++
+
+	return false, nil, user.ErrNotFound
+}
+
+func (r *flappingRepository) AddPendingUserTicket(_ context.Context, _ user.DbProcessedMessage, ticket user.DbPendingUserTicket) (bool, error) {
+	return false, fmt.Errorf("%w: user %s already exists", user.ErrConflict, ticket.UserId)
+}
+
+func TestHandleBookMessageRetriesOnce(t *testing.T) {
+	repository := &flappingRepository{MemoryRepository: user.NewMemoryRepository()}
+	service := NewService(repository)
+
+	err := service.HandleBookMessage(context.Background(), zap.NewNop(), bookMessage("m1"), pkg.BookMessage{UserId: uuid.New(), TicketId: "t1"})
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Fatalf("got error %v, want %v", err, ErrUserAlreadyExists)
+	}
+
+	if repository.inserts != bookMessageAttempts {
+		t.Fatalf("got %d inserts, want %d", repository.inserts, bookMessageAttempts)
+	}
+}
+
+// TestUpdateUserKeepsVerification проверяет, что обычное обновление не сбрасывает поля, которые меняет только администратор
+func TestUpdateUserKeepsVerification(t *testing.T) {
+	ctx := context.Background()
+	log := zap.NewNop()
+	service := NewService(user.NewMemoryRepository())
+
+	id, err := service.AddUser(ctx, log, pkg.User{Email: "verified@example.com"})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+
+	verification := pkg.UserVerification{Status: pkg.UserStatusSuspended, Verified: true, BirthDate: birthDate(2000, time.January, 1)}
+	if err = service.UpdateUserVerification(ctx, log, id, verification); err != nil {
+		t.Fatalf("could not update verification: %v", err)
+	}
+
+	if err = service.UpdateUser(ctx, log, pkg.User{Id: id, Email: "verified@example.com", Name: "updated"}); err != nil {
+		t.Fatalf("could not update user: %v", err)
+	}
+
+	if err = service.UpdateUserVerification(ctx, log, id, pkg.UserVerification{Verified: true, BirthDate: verification.BirthDate}); err != nil {
+		t.Fatalf("could not update verification: %v", err)
+	}
+
+	got, err := service.GetUserById(ctx, log, id)
+	if err != nil {
+		t.Fatalf("could not get user: %v", err)
+	}
+	if got.Name != "updated" || got.Status != verification.Status || !got.Verified || !got.BirthDate.Equal(*verification.BirthDate) {
+		t.Fatalf("unexpected user: %+v", got)
+	}
+
+	err = service.UpdateUserVerification(ctx, log, id, pkg.UserVerification{Status: "deleted"})
+	if !errors.Is(err, ErrInvalidUser) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidUser)
+	}
+}
@@ -3,23 +3,40 @@ package user
 import (
 	"user-service/db/user"
 	"user-service/pkg"
+
+	"github.com/google/uuid"
 )
 
 func MapUserToService(db user.DbUser) pkg.User {
 	return pkg.User{
-		Id:      db.Id,
-		Email:   db.Email,
-		Name:    db.Name,
-		Surname: db.Surname,
+		Id:        db.Id,
+		Email:     db.Email,
+		Name:      db.Name,
+		Surname:   db.Surname,
+		Status:    db.Status,
+		Verified:  db.Verified,
+		BirthDate: db.BirthDate,
 	}
 }
 
 func MapUserToDb(service pkg.User) user.DbUser {
 	return user.DbUser{
-		Id:      service.Id,
-		Email:   service.Email,
-		Name:    service.Name,
-		Surname: service.Surname,
+		Id:        service.Id,
+		Email:     service.Email,
+		Name:      service.Name,
+		Surname:   service.Surname,
+		Status:    service.Status,
+		Verified:  service.Verified,
+		BirthDate: service.BirthDate,
+	}
+}
+
+func MapUserVerificationToDb(id uuid.UUID, service pkg.UserVerification) user.DbUserVerification {
+	return user.DbUserVerification{
+		Id:        id,
+		Status:    service.Status,
+		Verified:  service.Verified,
+		BirthDate: service.BirthDate,
 	}
 }
 
@@ -27,5 +44,29 @@ func MapUserTicketToService(db user.DbUserTicket) pkg.UserTicket {
 	return pkg.UserTicket{
 		UserId:   db.UserId,
 		TicketId: db.TicketId,
+		EventId:  db.EventId,
+	}
+}
+
+func MapTicketTransferToService(db user.DbTicketTransfer) pkg.TicketTransfer {
+	return pkg.TicketTransfer{
+		Id:            db.Id,
+		TicketId:      db.TicketId,
+		FromUserId:    db.FromUserId,
+		ToUserId:      db.ToUserId,
+		InitiatedBy:   db.InitiatedBy,
+		TransferredAt: db.TransferredAt,
+	}
+}
+
+func MapTicketConflictToService(db user.DbTicketConflict) pkg.TicketConflict {
+	return pkg.TicketConflict{
+		Id:          db.Id,
+		TicketId:    db.TicketId,
+		UserId:      db.UserId,
+		OwnerUserId: db.OwnerUserId,
+		MessageId:   db.MessageId,
+		Source:      db.Source,
+		DetectedAt:  db.DetectedAt,
 	}
 }
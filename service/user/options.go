@@ -0,0 +1,32 @@
+package user
+
+import (
+	"time"
+)
+
+type ServiceOptions struct {
+	Policy *Policy
+	Now    func() time.Time
+}
+
+type ServiceOption func(o ServiceOptions) ServiceOptions
+
+// WithPolicy задает правила приема бронирований. Без них принимается любое бронирование
+func WithPolicy(policy *Policy) ServiceOption {
+	return func(o ServiceOptions) ServiceOptions {
+		o.Policy = policy
+		return o
+	}
+}
+
+func newServiceOptions(options []ServiceOption) ServiceOptions {
+	opt := ServiceOptions{
+		Now: time.Now,
+	}
+
+	for _, option := range options {
+		opt = option(opt)
+	}
+
+	return opt
+}
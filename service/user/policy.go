@@ -0,0 +1,138 @@
+package user
+
+import (
+	"context"
+	"time"
+	"user-service/db/user"
+	"user-service/pkg"
+)
+
+const (
+	ReasonTicketLimit    = "ticket_limit"
+	ReasonUserSuspended  = "user_suspended"
+	ReasonUserUnverified = "user_unverified"
+	ReasonAgeRestricted  = "age_restricted"
+	ReasonAgeUnknown     = "age_unknown"
+)
+
+// Booking бронирование, которое проверяют правила. Accepted - уже принятые бронирования той же пачки
+type Booking struct {
+	User     pkg.User
+	Message  pkg.BookMessage
+	Accepted []pkg.BookMessage
+}
+
+// Rule проверяет бронирование и возвращает код причины отказа или пустую строку, если бронирование допустимо
+type Rule func(ctx context.Context, booking Booking) (string, error)
+
+// Policy набор правил приема бронирований. Правила применяются по порядку до первого отказа
+type Policy struct {
+	rules []Rule
+}
+
+func NewPolicy(rules ...Rule) *Policy {
+	return &Policy{
+		rules: rules,
+	}
+}
+
+func (p *Policy) Empty() bool {
+	return p == nil || len(p.rules) == 0
+}
+
+// Evaluate возвращает причину первого отказа или пустую строку, если бронирование прошло все правила
+func (p *Policy) Evaluate(ctx context.Context, booking Booking) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+
+	for _, rule := range p.rules {
+		reason, err := rule(ctx, booking)
+		if err != nil || len(reason) > 0 {
+			return reason, err
+		}
+	}
+
+	return "", nil
+}
+
+// MaxTicketsPerEvent ограничивает число билетов пользователя на одно событие. Бронирования без EventId не проверяются.
+// Билеты считаются в транзакции из ctx, сервис вызывает правило после блокировки пользователя в транзакции вставки
+func MaxTicketsPerEvent(repository user.Repository, limit int) Rule {
+	return func(ctx context.Context, booking Booking) (string, error) {
+		msg := booking.Message
+		if len(msg.EventId) == 0 {
+			return "", nil
+		}
+
+		count, err := repository.CountUserTicketsByEvent(ctx, msg.UserId, msg.EventId, msg.TicketId)
+		if err != nil {
+			return "", err
+		}
+
+		for _, accepted := range booking.Accepted {
+			if accepted.UserId == msg.UserId && accepted.EventId == msg.EventId && accepted.TicketId != msg.TicketId {
+				count++
+			}
+		}
+
+		if count >= limit {
+			return ReasonTicketLimit, nil
+		}
+
+		return "", nil
+	}
+}
+
+// RejectSuspended отклоняет бронирования заблокированных пользователей
+func RejectSuspended() Rule {
+	return func(_ context.Context, booking Booking) (string, error) {
+		if booking.User.Status == pkg.UserStatusSuspended {
+			return ReasonUserSuspended, nil
+		}
+
+		return "", nil
+	}
+}
+
+// RequireVerified отклоняет бронирования неподтвержденных пользователей
+func RequireVerified() Rule {
+	return func(_ context.Context, booking Booking) (string, error) {
+		if !booking.User.Verified {
+			return ReasonUserUnverified, nil
+		}
+
+		return "", nil
+	}
+}
+
+// MinAge проверяет возраст пользователя по дате рождения. Ограничение берется наибольшее из years и MinAge бронирования,
+// бронирование с ограничением у пользователя без даты рождения отклоняется
+func MinAge(years int, now func() time.Time) Rule {
+	return func(_ context.Context, booking Booking) (string, error) {
+		required := max(years, booking.Message.MinAge)
+		if required <= 0 {
+			return "", nil
+		}
+
+		if booking.User.BirthDate == nil {
+			return ReasonAgeUnknown, nil
+		}
+
+		if age(*booking.User.BirthDate, now()) < required {
+			return ReasonAgeRestricted, nil
+		}
+
+		return "", nil
+	}
+}
+
+// age возвращает число полных лет на момент now
+func age(birthDate, now time.Time) int {
+	years := now.Year() - birthDate.Year()
+	if now.Month() < birthDate.Month() || (now.Month() == birthDate.Month() && now.Day() < birthDate.Day()) {
+		years--
+	}
+
+	return years
+}
@@ -0,0 +1,356 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"user-service/db"
+	"user-service/db/user"
+	"user-service/kafka"
+	"user-service/pkg"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var testNow = time.Date(2026, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+func birthDate(year int, month time.Month, day int) *time.Time {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &date
+}
+
+func bookMessage(id string) kafka.Message {
+	return kafka.Message{Headers: []kafka.Header{{Key: kafka.HeaderMessageId, Value: []byte(id)}}}
+}
+
+// rejectionRepository запоминает отказы, которые MemoryRepository не пишет в outbox
+type rejectionRepository struct {
+	*user.MemoryRepository
+
+	mutex      *sync.Mutex
+	rejections []user.DbBookingRejection
+}
+
+func newRejectionRepository() *rejectionRepository {
+	return &rejectionRepository{
+		MemoryRepository: user.NewMemoryRepository(),
+		mutex:            &sync.Mutex{},
+	}
+}
+
+func (r *rejectionRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repository user.Repository) error, options ...db.TxOption) error {
+	return r.MemoryRepository.WithTx(ctx, func(ctx context.Context, _ user.Repository) error {
+		return fn(ctx, r)
+	}, options...)
+}
+
+func (r *rejectionRepository) AddBookingRejected(_ context.Context, rejection user.DbBookingRejection) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rejections = append(r.rejections, rejection)
+
+	return nil
+}
+
+func (r *rejectionRepository) reasons() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	reasons := make([]string, 0, len(r.rejections))
+	for _, rejection := range r.rejections {
+		reasons = append(reasons, rejection.TicketId+":"+rejection.Reason)
+	}
+
+	return reasons
+}
+
+// callsRepository записывает порядок транзакций, блокировок, подсчета и вставки билетов
+type callsRepository struct {
+	*user.MemoryRepository
+
+	calls []string
+}
+
+func (r *callsRepository) WithTx(ctx context.Context, fn func(ctx context.Context, repository user.Repository) error, options ...db.TxOption) error {
+	r.calls = append(r.calls, "begin")
+	err := r.MemoryRepository.WithTx(ctx, func(ctx context.Context, _ user.Repository) error {
+		return fn(ctx, r)
+	}, options...)
+	r.calls = append(r.calls, "end")
+
+	return err
+}
+
+func (r *callsRepository) LockUsersByIds(ctx context.Context, ids []uuid.UUID) ([]user.DbUser, error) {
+	r.calls = append(r.calls, "lock")
+
+	return r.MemoryRepository.LockUsersByIds(ctx, ids)
+}
+
+func (r *callsRepository) CountUserTicketsByEvent(ctx context.Context, userId uuid.UUID, eventId, exceptTicketId string) (int, error) {
+	r.calls = append(r.calls, "count")
+
+	return r.MemoryRepository.CountUserTicketsByEvent(ctx, userId, eventId, exceptTicketId)
+}
+
+func (r *callsRepository) AddUserTicketFromMessage(ctx context.Context, message user.DbProcessedMessage, userTicket user.DbUserTicket) (bool, []user.DbTicketConflict, error) {
+	r.calls = append(r.calls, "insert")
+
+	return r.MemoryRepository.AddUserTicketFromMessage(ctx, message, userTicket)
+}
+
+func TestMaxTicketsPerEvent(t *testing.T) {
+	ctx := context.Background()
+	repository := user.NewMemoryRepository()
+
+	userId, err := repository.AddUser(ctx, user.DbUser{Email: "limit@example.com"})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+
+	for _, ticketId := range []string{"t1", "t2"} {
+		if err = repository.AddUserTicket(ctx, user.DbUserTicket{UserId: userId, TicketId: ticketId, EventId: "e1"}); err != nil {
+			t.Fatalf("could not add ticket: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		message  pkg.BookMessage
+		accepted []pkg.BookMessage
+		reason   string
+	}{
+		{name: "under limit", limit: 3, message: pkg.BookMessage{UserId: userId, TicketId: "t3", EventId: "e1"}},
+		{name: "at limit", limit: 2, message: pkg.BookMessage{UserId: userId, TicketId: "t3", EventId: "e1"}, reason: ReasonTicketLimit},
+		{name: "same ticket again", limit: 2, message: pkg.BookMessage{UserId: userId, TicketId: "t2", EventId: "e1"}},
+		{name: "other event", limit: 2, message: pkg.BookMessage{UserId: userId, TicketId: "t3", EventId: "e2"}},
+		{name: "no event", limit: 1, message: pkg.BookMessage{UserId: userId, TicketId: "t3"}},
+		{
+			name:     "accepted in batch",
+			limit:    3,
+			message:  pkg.BookMessage{UserId: userId, TicketId: "t4", EventId: "e1"},
+			accepted: []pkg.BookMessage{{UserId: userId, TicketId: "t3", EventId: "e1"}},
+			reason:   ReasonTicketLimit,
+		},
+		{
+			name:     "accepted in batch for other user",
+			limit:    3,
+			message:  pkg.BookMessage{UserId: userId, TicketId: "t4", EventId: "e1"},
+			accepted: []pkg.BookMessage{{UserId: uuid.New(), TicketId: "t3", EventId: "e1"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason, err := MaxTicketsPerEvent(repository, test.limit)(ctx, Booking{
+				User:     pkg.User{Id: userId},
+				Message:  test.message,
+				Accepted: test.accepted,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reason != test.reason {
+				t.Fatalf("got reason %q, want %q", reason, test.reason)
+			}
+		})
+	}
+}
+
+func TestUserRules(t *testing.T) {
+	now := func() time.Time {
+		return testNow
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		user    pkg.User
+		message pkg.BookMessage
+		reason  string
+	}{
+		{name: "active user", rule: RejectSuspended(), user: pkg.User{Status: pkg.UserStatusActive}},
+		{name: "suspended user", rule: RejectSuspended(), user: pkg.User{Status: pkg.UserStatusSuspended}, reason: ReasonUserSuspended},
+		{name: "verified user", rule: RequireVerified(), user: pkg.User{Verified: true}},
+		{name: "unverified user", rule: RequireVerified(), user: pkg.User{}, reason: ReasonUserUnverified},
+		{name: "no age limit", rule: MinAge(0, now), user: pkg.User{}},
+		{name: "old enough", rule: MinAge(18, now), user: pkg.User{BirthDate: birthDate(2008, time.June, 15)}},
+		{name: "day before birthday", rule: MinAge(18, now), user: pkg.User{BirthDate: birthDate(2008, time.June, 16)}, reason: ReasonAgeRestricted},
+		{name: "unknown age", rule: MinAge(18, now), user: pkg.User{}, reason: ReasonAgeUnknown},
+		{
+			name:    "message age limit above config",
+			rule:    MinAge(16, now),
+			user:    pkg.User{BirthDate: birthDate(2009, time.January, 1)},
+			message: pkg.BookMessage{MinAge: 18},
+			reason:  ReasonAgeRestricted,
+		},
+		{
+			name:    "message age limit below config",
+			rule:    MinAge(18, now),
+			user:    pkg.User{BirthDate: birthDate(2009, time.January, 1)},
+			message: pkg.BookMessage{MinAge: 16},
+			reason:  ReasonAgeRestricted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason, err := test.rule(context.Background(), Booking{User: test.user, Message: test.message})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reason != test.reason {
+				t.Fatalf("got reason %q, want %q", reason, test.reason)
+			}
+		})
+	}
+}
+
+func TestPolicyStopsAtFirstRejection(t *testing.T) {
+	policy := NewPolicy(RejectSuspended(), RequireVerified())
+
+	reason, err := policy.Evaluate(context.Background(), Booking{User: pkg.User{Status: pkg.UserStatusSuspended}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reason != ReasonUserSuspended {
+		t.Fatalf("got reason %q, want %q", reason, ReasonUserSuspended)
+	}
+}
+
+// TestHandleBookMessagesCountsAccepted проверяет, что лимит учитывает билеты, принятые раньше в той же пачке
+func TestHandleBookMessagesCountsAccepted(t *testing.T) {
+	ctx := context.Background()
+	repository := newRejectionRepository()
+	service := NewService(repository, WithPolicy(NewPolicy(MaxTicketsPerEvent(repository, 2))))
+
+	userId, err := repository.AddUser(ctx, user.DbUser{Email: "batch@example.com"})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+
+	messages := make([]kafka.Message, 0, 3)
+	msgs := make([]pkg.BookMessage, 0, 3)
+	for i := 1; i <= 3; i++ {
+		messages = append(messages, bookMessage(fmt.Sprintf("m%d", i)))
+		msgs = append(msgs, pkg.BookMessage{UserId: userId, TicketId: fmt.Sprintf("t%d", i), EventId: "e1"})
+	}
+
+	if err = service.HandleBookMessages(ctx, zap.NewNop(), messages, msgs); err != nil {
+		t.Fatalf("could not handle messages: %v", err)
+	}
+
+	tickets, err := repository.GetUserTicketsByUserId(ctx, userId)
+	if err != nil {
+		t.Fatalf("could not get tickets: %v", err)
+	}
+	if len(tickets) != 2 {
+		t.Fatalf("got %d tickets, want 2", len(tickets))
+	}
+
+	if reasons := repository.reasons(); len(reasons) != 1 || reasons[0] != "t3:"+ReasonTicketLimit {
+		t.Fatalf("unexpected rejections: %v", reasons)
+	}
+}
+
+// TestTicketLimitCheckedInInsertTransaction проверяет, что лимит считается после блокировки пользователя
+// в той же транзакции, что и вставка билета
+func TestTicketLimitCheckedInInsertTransaction(t *testing.T) {
+	ctx := context.Background()
+	repository := &callsRepository{MemoryRepository: user.NewMemoryRepository()}
+	service := NewService(repository, WithPolicy(NewPolicy(MaxTicketsPerEvent(repository, 1))))
+
+	userId, err := repository.AddUser(ctx, user.DbUser{Email: "locked@example.com"})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+
+	err = service.HandleBookMessage(ctx, zap.NewNop(), bookMessage("m1"), pkg.BookMessage{UserId: userId, TicketId: "t1", EventId: "e1"})
+	if err != nil {
+		t.Fatalf("could not handle message: %v", err)
+	}
+
+	if calls := strings.Join(repository.calls, ","); calls != "begin,lock,count,insert,end" {
+		t.Fatalf("got calls %s", calls)
+	}
+}
+
+// TestRedeliveryIsNotRejected проверяет, что уже принятое сообщение не отклоняется при повторной доставке
+func TestRedeliveryIsNotRejected(t *testing.T) {
+	ctx := context.Background()
+	log := zap.NewNop()
+	repository := newRejectionRepository()
+	service := NewService(repository, WithPolicy(NewPolicy(RejectSuspended())))
+
+	userId, err := repository.AddUser(ctx, user.DbUser{Email: "redelivery@example.com"})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+
+	message := bookMessage("m1")
+	msg := pkg.BookMessage{UserId: userId, TicketId: "t1"}
+	if err = service.HandleBookMessage(ctx, log, message, msg); err != nil {
+		t.Fatalf("could not handle message: %v", err)
+	}
+
+	err = repository.UpdateUserVerification(ctx, user.DbUserVerification{Id: userId, Status: pkg.UserStatusSuspended})
+	if err != nil {
+		t.Fatalf("could not suspend user: %v", err)
+	}
+
+	if err = service.HandleBookMessage(ctx, log, message, msg); err != nil {
+		t.Fatalf("could not handle redelivered message: %v", err)
+	}
+
+	if reasons := repository.reasons(); len(reasons) != 0 {
+		t.Fatalf("redelivered message was rejected: %v", reasons)
+	}
+}
+
+// TestAddUserAppliesPolicyToPendingTickets проверяет, что билеты, забронированные до появления пользователя,
+// привязываются только после проверки политикой
+func TestAddUserAppliesPolicyToPendingTickets(t *testing.T) {
+	ctx := context.Background()
+	log := zap.NewNop()
+	repository := newRejectionRepository()
+	service := NewService(repository, WithPolicy(NewPolicy(
+		MinAge(0, func() time.Time { return testNow }),
+		MaxTicketsPerEvent(repository, 1),
+	)))
+
+	userId := uuid.New()
+	bookings := []pkg.BookMessage{
+		{UserId: userId, TicketId: "t1", EventId: "e1"},
+		{UserId: userId, TicketId: "t2", EventId: "e1"},
+		{UserId: userId, TicketId: "t3", EventId: "e2", MinAge: 21},
+	}
+	for i, msg := range bookings {
+		if err := service.HandleBookMessage(ctx, log, bookMessage(fmt.Sprintf("m%d", i+1)), msg); err != nil {
+			t.Fatalf("could not handle message: %v", err)
+		}
+	}
+
+	_, err := service.AddUser(ctx, log, pkg.User{Id: userId, Email: "pending@example.com", BirthDate: birthDate(2008, time.January, 1)})
+	if err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+
+	tickets, err := repository.GetUserTicketsByUserId(ctx, userId)
+	if err != nil {
+		t.Fatalf("could not get tickets: %v", err)
+	}
+	if len(tickets) != 1 || tickets[0].TicketId != "t1" {
+		t.Fatalf("unexpected attached tickets: %v", tickets)
+	}
+
+	reasons := repository.reasons()
+	if len(reasons) != 2 || reasons[0] != "t2:"+ReasonTicketLimit || reasons[1] != "t3:"+ReasonAgeRestricted {
+		t.Fatalf("unexpected rejections: %v", reasons)
+	}
+}
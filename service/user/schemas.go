@@ -0,0 +1,42 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"user-service/kafka"
+	"user-service/pkg"
+)
+
+type messageSchema struct {
+	messageType string
+	version     int
+	file        string
+	upcaster    kafka.Upcaster
+}
+
+var messageSchemas = []messageSchema{
+	{messageType: pkg.BookMessageType, version: 1, file: "schemas/book_message.v1.json", upcaster: upcastBookMessageV1},
+	{messageType: pkg.BookMessageType, version: 2, file: "schemas/book_message.v2.json"},
+}
+
+// upcastBookMessageV1 переводит BookMessage v1 во вторую версию. Новые поля EventId и MinAge необязательны,
+// поэтому payload первой версии уже подходит ко второй
+func upcastBookMessageV1(payload json.RawMessage) (json.RawMessage, error) {
+	return payload, nil
+}
+
+// RegisterMessageSchemas регистрирует схемы всех сообщений, которые обрабатывает сервис
+func RegisterMessageSchemas(schemas *kafka.Schemas) error {
+	for _, s := range messageSchemas {
+		document, err := pkg.Schemas.ReadFile(s.file)
+		if err != nil {
+			return fmt.Errorf("could not read schema %s: %w", s.file, err)
+		}
+
+		if err = schemas.Register(s.messageType, s.version, document, s.upcaster); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package user
+
+import (
+	"bytes"
+	"testing"
+	"user-service/kafka"
+	"user-service/pkg"
+
+	"github.com/google/uuid"
+)
+
+func TestBookMessageShardKey(t *testing.T) {
+	schemas := kafka.NewSchemas()
+	if err := RegisterMessageSchemas(schemas); err != nil {
+		t.Fatalf("could not register schemas: %v", err)
+	}
+
+	shardKey := NewBookMessageShardKey(schemas)
+	userId := uuid.New()
+	msg := pkg.BookMessage{UserId: userId, TicketId: "t1", EventId: "e1"}
+
+	plain, err := kafka.NewJSONMessage("order-1", msg)
+	if err != nil {
+		t.Fatalf("could not build message: %v", err)
+	}
+
+	enveloped, err := kafka.NewEnvelopeMessage("order-2", pkg.BookMessageType, 2, "tickets", msg)
+	if err != nil {
+		t.Fatalf("could not build envelope: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		message kafka.Message
+		key     []byte
+	}{
+		{name: "plain message", message: plain, key: userId[:]},
+		{name: "envelope", message: enveloped, key: userId[:]},
+		{name: "malformed", message: kafka.Message{Key: []byte("order-3"), Value: []byte("{")}, key: []byte("order-3")},
+		{
+			name:    "schema violation",
+			message: kafka.Message{Key: []byte("order-4"), Value: []byte(`{"UserId":"` + userId.String() + `"}`)},
+			key:     []byte("order-4"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key := shardKey(test.message); !bytes.Equal(key, test.key) {
+				t.Fatalf("got shard key %x, want %x", key, test.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package sync
+
+import (
+	"context"
+	"time"
+)
+
+// Every вызывает fn с интервалом interval, пока не отменен ctx
+func Every(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}